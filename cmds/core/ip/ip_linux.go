@@ -19,7 +19,11 @@ import (
 	"github.com/vishvananda/netlink"
 )
 
-var inet6 = flag.BoolP("6", "6", false, "use ipv6")
+var (
+	inet6   = flag.BoolP("6", "6", false, "use ipv6")
+	jsonOut = flag.BoolP("json", "j", false, "output in JSON format, using the same field names as iproute2")
+	pretty  = flag.BoolP("pretty", "p", false, "indent JSON output; only meaningful with -j")
+)
 
 // The language implemented by the standard 'ip' is not super consistent
 // and has lots of convenience shortcuts.
@@ -144,6 +148,9 @@ func addrip(w io.Writer) error {
 }
 
 func neigh(w io.Writer) error {
+	if *jsonOut {
+		return errJSONUnsupported
+	}
 	if len(arg) != 1 {
 		return errors.New("neigh subcommands not supported yet")
 	}
@@ -247,6 +254,9 @@ func link(w io.Writer) error {
 }
 
 func routeshow(w io.Writer) error {
+	if *jsonOut {
+		return errJSONUnsupported
+	}
 	return showRoutes(w, *inet6)
 }
 
@@ -5,6 +5,8 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -15,12 +17,95 @@ import (
 	"golang.org/x/sys/unix"
 )
 
+var errJSONUnsupported = errors.New("JSON output is not supported for this command yet")
+
+// linkJSON is one interface as iproute2 prints it with -j, so that tools
+// parsing iproute2's JSON output also work with ours.
+type linkJSON struct {
+	IfIndex   int        `json:"ifindex"`
+	IfName    string     `json:"ifname"`
+	Flags     []string   `json:"flags"`
+	MTU       int        `json:"mtu"`
+	Master    string     `json:"master,omitempty"`
+	OperState string     `json:"operstate"`
+	LinkType  string     `json:"link_type"`
+	Address   string     `json:"address,omitempty"`
+	AddrInfo  []addrJSON `json:"addr_info,omitempty"`
+}
+
+// addrJSON is one entry of iproute2's addr_info array.
+type addrJSON struct {
+	Family            string `json:"family"`
+	Local             string `json:"local"`
+	PrefixLen         int    `json:"prefixlen"`
+	Broadcast         string `json:"broadcast,omitempty"`
+	Scope             string `json:"scope"`
+	Label             string `json:"label,omitempty"`
+	ValidLifeTime     uint32 `json:"valid_life_time"`
+	PreferredLifeTime uint32 `json:"preferred_life_time"`
+}
+
+// linkFlags returns the names of the flags set in l, e.g. UP, BROADCAST.
+func linkFlags(l *netlink.LinkAttrs) []string {
+	if l.Flags == 0 {
+		return []string{}
+	}
+	return strings.Split(strings.ToUpper(l.Flags.String()), "|")
+}
+
+func newLinkJSON(l *netlink.LinkAttrs, master string) linkJSON {
+	j := linkJSON{
+		IfIndex:   l.Index,
+		IfName:    l.Name,
+		Flags:     linkFlags(l),
+		MTU:       l.MTU,
+		Master:    master,
+		OperState: strings.ToUpper(l.OperState.String()),
+		LinkType:  l.EncapType,
+	}
+	if l.HardwareAddr != nil {
+		j.Address = l.HardwareAddr.String()
+	}
+	return j
+}
+
+func newAddrJSON(addr netlink.Addr) addrJSON {
+	family := "inet"
+	if addr.IP.To4() == nil {
+		family = "inet6"
+	}
+	ones, _ := addr.Mask.Size()
+	j := addrJSON{
+		Family:            family,
+		Local:             addr.IP.String(),
+		PrefixLen:         ones,
+		Scope:             addrScopes[netlink.Scope(addr.Scope)],
+		Label:             addr.Label,
+		ValidLifeTime:     uint32(addr.ValidLft),
+		PreferredLifeTime: uint32(addr.PreferedLft),
+	}
+	if addr.Broadcast != nil {
+		j.Broadcast = addr.Broadcast.String()
+	}
+	return j
+}
+
+// printJSON writes v to w as JSON, indented if -p was given.
+func printJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	if *pretty {
+		enc.SetIndent("", "    ")
+	}
+	return enc.Encode(v)
+}
+
 func showLinks(w io.Writer, withAddresses bool) error {
 	ifaces, err := netlink.LinkList()
 	if err != nil {
 		return fmt.Errorf("can't enumerate interfaces: %v", err)
 	}
 
+	links := []linkJSON{}
 	for _, v := range ifaces {
 		l := v.Attrs()
 
@@ -30,10 +115,29 @@ func showLinks(w io.Writer, withAddresses bool) error {
 			if err != nil {
 				return fmt.Errorf("can't get link with index %d: %v", l.MasterIndex, err)
 			}
-			master = fmt.Sprintf("master %s ", link.Attrs().Name)
+			master = link.Attrs().Name
+		}
+
+		if *jsonOut {
+			j := newLinkJSON(l, master)
+			if withAddresses {
+				addrs, err := netlink.AddrList(v, netlink.FAMILY_ALL)
+				if err != nil {
+					return fmt.Errorf("can't enumerate addresses: %v", err)
+				}
+				for _, addr := range addrs {
+					j.AddrInfo = append(j.AddrInfo, newAddrJSON(addr))
+				}
+			}
+			links = append(links, j)
+			continue
+		}
+
+		if master != "" {
+			master = fmt.Sprintf("master %s ", master)
 		}
 		fmt.Fprintf(w, "%d: %s: <%s> mtu %d %sstate %s\n", l.Index, l.Name,
-			strings.Replace(strings.ToUpper(l.Flags.String()), "|", ",", -1),
+			strings.Join(linkFlags(l), ","),
 			l.MTU, master, strings.ToUpper(l.OperState.String()))
 
 		fmt.Fprintf(w, "    link/%s %s\n", l.EncapType, l.HardwareAddr)
@@ -42,6 +146,9 @@ func showLinks(w io.Writer, withAddresses bool) error {
 			showLinkAddresses(w, v)
 		}
 	}
+	if *jsonOut {
+		return printJSON(w, links)
+	}
 	return nil
 }
 
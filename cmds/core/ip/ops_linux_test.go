@@ -0,0 +1,85 @@
+// Copyright 2026 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestLinkJSON(t *testing.T) {
+	hw, _ := net.ParseMAC("52:54:00:12:34:56")
+	j := newLinkJSON(&netlink.LinkAttrs{
+		Index:        2,
+		Name:         "eth0",
+		Flags:        net.FlagUp | net.FlagBroadcast,
+		MTU:          1500,
+		OperState:    netlink.OperUp,
+		EncapType:    "ether",
+		HardwareAddr: hw,
+	}, "br0")
+	j.AddrInfo = append(j.AddrInfo, newAddrJSON(netlink.Addr{
+		IPNet:       &net.IPNet{IP: net.IPv4(10, 0, 2, 15), Mask: net.CIDRMask(24, 32)},
+		Broadcast:   net.IPv4(10, 0, 2, 255),
+		Label:       "eth0",
+		ValidLft:    86400,
+		PreferedLft: 86400,
+	}))
+
+	for _, tt := range []struct {
+		pretty bool
+		want   string
+	}{
+		{
+			pretty: false,
+			want: `[{"ifindex":2,"ifname":"eth0","flags":["UP","BROADCAST"],"mtu":1500,"master":"br0","operstate":"UP","link_type":"ether","address":"52:54:00:12:34:56",` +
+				`"addr_info":[{"family":"inet","local":"10.0.2.15","prefixlen":24,"broadcast":"10.0.2.255","scope":"global","label":"eth0","valid_life_time":86400,"preferred_life_time":86400}]}]` + "\n",
+		},
+		{
+			pretty: true,
+			want: `[
+    {
+        "ifindex": 2,
+        "ifname": "eth0",
+        "flags": [
+            "UP",
+            "BROADCAST"
+        ],
+        "mtu": 1500,
+        "master": "br0",
+        "operstate": "UP",
+        "link_type": "ether",
+        "address": "52:54:00:12:34:56",
+        "addr_info": [
+            {
+                "family": "inet",
+                "local": "10.0.2.15",
+                "prefixlen": 24,
+                "broadcast": "10.0.2.255",
+                "scope": "global",
+                "label": "eth0",
+                "valid_life_time": 86400,
+                "preferred_life_time": 86400
+            }
+        ]
+    }
+]
+`,
+		},
+	} {
+		*pretty = tt.pretty
+		var b bytes.Buffer
+		if err := printJSON(&b, []linkJSON{j}); err != nil {
+			t.Fatalf("printJSON() = %v", err)
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("printJSON(pretty=%t) =\n%s\nwant\n%s", tt.pretty, got, tt.want)
+		}
+	}
+	*pretty = false
+}
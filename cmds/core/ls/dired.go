@@ -0,0 +1,100 @@
+// Copyright 2026 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/ls"
+)
+
+// With --dired, names are bracketed by these markers while the listing is
+// formatted. NUL cannot occur in file names, so writeDired can find them
+// after tabwriter has aligned the columns, record their offsets and drop
+// them.
+const (
+	diredNameStart = "\x00n"
+	diredNameEnd   = "\x00N"
+	diredDirStart  = "\x00s"
+	diredDirEnd    = "\x00S"
+)
+
+// diredStringer marks the output of Name as a file name for writeDired.
+type diredStringer struct {
+	Name ls.Stringer
+}
+
+// FileString implements ls.Stringer.FileString.
+func (ds diredStringer) FileString(fi ls.FileInfo) string {
+	return diredNameStart + ds.Name.FileString(fi) + diredNameEnd
+}
+
+// diredClassify adds the -F indicator ind to s, the marked output for a file,
+// just after the name, so that its //DIRED// span covers only the name.
+func diredClassify(s, ind string) string {
+	return strings.Replace(s, diredNameEnd, diredNameEnd+ind, 1)
+}
+
+// writeDired writes the marked listing out to w in the format of GNU
+// ls --dired: every line indented by two spaces, followed by the byte
+// offsets of the start and end of each file name, and of each directory name
+// in a header, and the quoting style of the names.
+func writeDired(w io.Writer, out []byte, quoted bool) error {
+	var (
+		res           bytes.Buffer
+		names, subdir []int
+	)
+	for _, line := range bytes.SplitAfter(out, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if line[0] != '\n' {
+			res.WriteString("  ")
+		}
+		for {
+			i := bytes.IndexByte(line, 0)
+			if i < 0 || i+1 == len(line) {
+				res.Write(line)
+				break
+			}
+			res.Write(line[:i])
+			switch string(line[i : i+2]) {
+			case diredNameStart, diredNameEnd:
+				names = append(names, res.Len())
+			case diredDirStart, diredDirEnd:
+				subdir = append(subdir, res.Len())
+			}
+			line = line[i+2:]
+		}
+	}
+
+	for _, d := range []struct {
+		prefix  string
+		offsets []int
+	}{
+		{"//DIRED//", names},
+		{"//SUBDIRED//", subdir},
+	} {
+		if len(d.offsets) == 0 {
+			continue
+		}
+		res.WriteString(d.prefix)
+		for _, o := range d.offsets {
+			fmt.Fprintf(&res, " %d", o)
+		}
+		res.WriteString("\n")
+	}
+	style := "literal"
+	if quoted {
+		style = "c"
+	}
+	fmt.Fprintf(&res, "//DIRED-OPTIONS// --quoting-style=%s\n", style)
+
+	_, err := w.Write(res.Bytes())
+	return err
+}
@@ -11,13 +11,44 @@
 // Options:
 //
 //	-a[ll]: show hidden files
-//	-h[uman-readable]: show human-readable sizes
+//	--glob=PATTERN: only list entries whose name matches PATTERN (see filepath.Match)
+//	-B|ignore-backups: do not list entries ending with ~
+//	--dot-hidden: do not list entries named in their directory's .hidden file, unless -a is given
+//	--hide=PATTERN: do not list entries whose name matches PATTERN, unless -a is given; may be repeated
+//	-h[uman-readable]: show human-readable sizes in powers of 1024
+//	--si: show human-readable sizes in powers of 1000; overrides -h
 //	-d[irectory]: show directories but not their contents
-//	-F|classify: append indicator (, one of */=>@|) to entries
+//	--no-headers: do not print a "dir:" header per directory when listing several
+//	--merge: list the entries of all DIRS as one sorted listing, each prefixed with its DIR
+//	-F|classify: append indicator (, one of */=>@|) to entries; ! marks dangling symlinks
+//	--dir-links: with -F, mark symlinks to directories with @/
 //	-l[ong]: long form
+//	-C|vertical: list entries in columns, sorted down the columns, as many as fit the terminal (80 wide otherwise)
+//	--columns=N: imply -C, with exactly N columns; rows wider than the terminal overflow it
+//	--link-targets: without -l, show symlinks as name -> target
+//	--dereference-size: show the size of symlink targets, but the symlink's own type
+//	--octal: with -l, also show permissions in octal
+//	--printf=FORMAT: print each entry as FORMAT, overriding -l; %n name, %s size, %m mode,
+//	  %a octal permissions, %t modification time, %T the same in seconds since the epoch, %% a %
+//	--dired: imply -l and append the byte offsets of names, as GNU ls does for Emacs dired
+//	-Z|context: show the SELinux security context of each file
 //	-Q|quote-name: quoted
+//	-q|hide-control-chars: print non-graphic characters in names as ?; the default on a terminal
+//	--show-control-chars: print names as they are, unless -q is given
 //	-R|recursive: equivalent to findutil's find
+//	--max-depth=N: with -R, descend into at most N levels of subdirectories below each argument; 0 lists as without -R
+//	--tree: list the tree below each argument, indented by depth with ├──/└── connectors, like tree(1)
 //	-s[ize]: sort by size
+//	-t|sort-time: sort by time, newest first
+//	-X|sort-extension: sort by extension, then name; names without extension come first
+//	--epoch: with -l, show times as seconds since the Unix epoch
+//	--time=WORD: show and sort by atime (access, use), ctime (status) or mtime (modification)
+//	-U: do not sort; list entries in directory order
+//	-f: same as -aU, and disables -l; overrides -S, -t and -X
+//	--zero: end each entry with NUL, not newline, and print names unmodified
+//	--root=DIR: list names as slash-separated paths in the file system rooted at DIR (an fs.FS),
+//	  e.g. "ls --root=/mnt etc"; symlinks are resolved as if DIR were / and -Z is ignored
+//	--pager: on a terminal, show listings longer than the screen through $PAGER (default more)
 //
 // Bugs:
 //
@@ -25,29 +56,94 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"os"
+	"os/exec"
+	"path"
 	"path/filepath"
 	"sort"
+	"strings"
 	"text/tabwriter"
+	"unicode/utf8"
 
 	flag "github.com/spf13/pflag"
 	"github.com/u-root/u-root/pkg/ls"
+	"golang.org/x/term"
 )
 
 type cmd struct {
-	w         io.Writer
+	w io.Writer
+	// fsys is the file system to list. If nil, the host's file system
+	// is listed, and names are interpreted relative to the current
+	// directory; otherwise, names must be valid fs.FS paths, e.g. the
+	// root of an in-memory cpio or tar image is ".".
+	fsys fs.FS
+
 	all       bool
 	human     bool
+	si        bool
 	directory bool
 	long      bool
 	quoted    bool
 	recurse   bool
 	classify  bool
 	size      bool
+	sortTime  bool
+	sortExt   bool
+	timeWord  string
+	timeField ls.TimeField
+	epoch     bool
+	octal     bool
+	context   bool
+	noBackups bool
+	zero      bool
+	derefSize bool
+	unsorted  bool
+	unsortAll bool
+	noHeaders bool
+	glob      string
+	hide      []string
+	// With limitDepth, -R descends into at most maxDepth levels of
+	// subdirectories below each argument; at 0, the argument is listed as
+	// without -R.
+	limitDepth bool
+	maxDepth   int
+	// linkTargets shows symlink targets in short mode, like -l does.
+	linkTargets bool
+	// dirLinks marks symlinks to directories with @/ under -F.
+	dirLinks bool
+	// merge lists the entries of all arguments as one sorted listing.
+	merge bool
+	// dired implies -l and appends the byte offsets of the listed
+	// names, for editors like Emacs.
+	dired bool
+	// printf, if set, is the ls.FormatStringer format of each entry.
+	printf string
+	// dotHidden omits the entries named in a directory's .hidden file,
+	// unless -a is given.
+	dotHidden bool
+	// hideControl prints non-graphic characters in names as '?';
+	// showControl prints names unmodified. Without either, only
+	// control characters are replaced.
+	hideControl bool
+	showControl bool
+	// decorate, if set, annotates every entry; see ls.RegisterDecorator.
+	decorate ls.Decorator
+	// grid lists entries in columns, sorted down the columns. With
+	// columns > 0 there are exactly that many, even if the rows are
+	// then wider than width; otherwise, as many as fit in width.
+	grid    bool
+	columns int
+	width   int
+	// cells collects the entries of the grid being listed.
+	cells *[]string
+	// tree lists the tree below each argument, like tree(1).
+	tree bool
 }
 
 // file describes a file, its name, attributes, and the error
@@ -80,12 +176,225 @@ type file struct {
 	osfi os.FileInfo
 	lsfi ls.FileInfo
 	err  error
+	// dangling is set for symlinks whose target does not exist, if -F
+	// was given.
+	dangling bool
+	// linkToDir is set for symlinks to directories, if -F and
+	// --dir-links were given.
+	linkToDir bool
 }
 
-func (c cmd) listName(stringer ls.Stringer, d string, prefix bool) error {
+// lstat returns the FileInfo of name in the listed file system.
+//
+// Symlinks are followed in an fs.FS that is not an ls.ReadLinkFS.
+func (c cmd) lstat(name string) (os.FileInfo, error) {
+	if c.fsys == nil {
+		return os.Lstat(name)
+	}
+	return ls.Lstat(c.fsys, name)
+}
+
+// stat returns the FileInfo of name in the listed file system, following
+// symlinks.
+func (c cmd) stat(name string) (os.FileInfo, error) {
+	if c.fsys == nil {
+		return os.Stat(name)
+	}
+	return fs.Stat(c.fsys, name)
+}
+
+// showContext reports whether -Z applies. Security contexts can only be read
+// from the host's file system.
+func (c cmd) showContext() bool {
+	return c.context && c.fsys == nil
+}
+
+// join joins a directory and a name in the listed file system.
+func (c cmd) join(dir, name string) string {
+	if c.fsys == nil {
+		return filepath.Join(dir, name)
+	}
+	return path.Join(dir, name)
+}
+
+// readDirNames returns the names in dir. They are sorted unless -U was given.
+func (c cmd) readDirNames(dir string) ([]string, error) {
+	var names []string
+	if c.fsys == nil {
+		f, err := os.Open(dir)
+		if err != nil {
+			return nil, err
+		}
+		names, err = f.Readdirnames(-1)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		f, err := c.fsys.Open(dir)
+		if err != nil {
+			return nil, err
+		}
+		d, ok := f.(fs.ReadDirFile)
+		if !ok {
+			f.Close()
+			return nil, &fs.PathError{Op: "readdir", Path: dir, Err: errors.New("not implemented")}
+		}
+		entries, err := d.ReadDir(-1)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+	}
+	if !c.unsorted {
+		sort.Strings(names)
+	}
+	return names, nil
+}
+
+// walk is filepath.Walk over the listed file system, except that directory
+// entries are visited in the order the file system returns them if -U was
+// given. That avoids holding and sorting all names of huge directories.
+func (c cmd) walk(root string, fn filepath.WalkFunc) error {
+	info, err := c.lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = c.walkDir(root, info, fn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func (c cmd) walkDir(dir string, info os.FileInfo, fn filepath.WalkFunc) error {
+	if !info.IsDir() {
+		return fn(dir, info, nil)
+	}
+
+	names, err := c.readDirNames(dir)
+	err1 := fn(dir, info, err)
+	// If err != nil, we can't walk into this directory; if err1 != nil,
+	// fn wants us to skip it or stop.
+	if err != nil || err1 != nil {
+		return err1
+	}
+
+	for _, name := range names {
+		filename := c.join(dir, name)
+		fileInfo, err := c.lstat(filename)
+		if err != nil {
+			if err := fn(filename, fileInfo, err); err != nil && err != filepath.SkipDir {
+				return err
+			}
+			continue
+		}
+		if err := c.walkDir(filename, fileInfo, fn); err != nil {
+			if !fileInfo.IsDir() || err != filepath.SkipDir {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// printLine prints one entry of the listing.
+func (c cmd) printLine(s string) {
+	if c.cells != nil {
+		*c.cells = append(*c.cells, s)
+		return
+	}
+	if c.zero {
+		// tabwriter only aligns newline-terminated lines; nulWriter
+		// drops the newline again.
+		fmt.Fprint(c.w, s+"\x00\n")
+		return
+	}
+	fmt.Fprintln(c.w, s)
+}
+
+// nulWriter writes the output of tabwriter to w with the newline that
+// follows each NUL-terminated entry removed. Names cannot contain NUL, so
+// only --zero entries end that way.
+type nulWriter struct {
+	w       io.Writer
+	lastNUL bool
+}
+
+// Write implements io.Writer.Write.
+func (n *nulWriter) Write(p []byte) (int, error) {
+	out := make([]byte, 0, len(p))
+	for _, b := range p {
+		if !(b == '\n' && n.lastNUL) {
+			out = append(out, b)
+		}
+		n.lastNUL = b == 0
+	}
+	if _, err := n.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// globFilter returns the files whose base name matches --glob. The argument
+// d itself and files that could not be read are always kept.
+func (c cmd) globFilter(files []file, d string) []file {
+	var matched []file
+	for _, f := range files {
+		// The pattern was validated in list.
+		if ok, _ := filepath.Match(c.glob, filepath.Base(f.path)); ok || f.path == d || f.err != nil {
+			matched = append(matched, f)
+		}
+	}
+	return matched
+}
+
+// depth returns how many levels below the listed argument d path is.
+func (c cmd) depth(d, path string) int {
+	rel, err := filepath.Rel(d, path)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(filepath.ToSlash(rel), "/") + 1
+}
+
+// ignored returns true if the entry at path is filtered out of listings.
+//
+// Arguments given on the command line are never ignored.
+func (c cmd) ignored(path string) bool {
+	if c.noBackups && strings.HasSuffix(path, "~") {
+		return true
+	}
+	if !c.all {
+		for _, pattern := range c.hide {
+			// The patterns were validated in list.
+			if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// collect returns the files to list for the argument d: d itself, and its
+// entries or, with -R, the whole tree below it.
+func (c cmd) collect(d string) []file {
 	var files []file
+	// The names hidden by .hidden files, by directory.
+	dotHidden := map[string]map[string]bool{}
+
+	c.walk(d, func(path string, osfi os.FileInfo, err error) error {
+		if path != d && (c.ignored(path) || c.isDotHidden(dotHidden, path)) {
+			if osfi != nil && osfi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
 
-	filepath.Walk(d, func(path string, osfi os.FileInfo, err error) error {
 		f := file{
 			path: path,
 			osfi: osfi,
@@ -93,7 +402,25 @@ func (c cmd) listName(stringer ls.Stringer, d string, prefix bool) error {
 
 		// error handling that matches standard ls is ... a real joy
 		if osfi != nil && !errors.Is(err, os.ErrNotExist) {
-			f.lsfi = ls.FromOSFileInfo(path, osfi)
+			if c.fsys == nil {
+				f.lsfi = ls.FromOSFileInfo(path, osfi)
+			} else {
+				f.lsfi = ls.FromFSFileInfo(c.fsys, path, osfi)
+			}
+			if c.showContext() {
+				f.lsfi.Context = ls.SecurityContext(path)
+			}
+			if c.classify && osfi.Mode()&os.ModeSymlink != 0 {
+				target, err := c.stat(path)
+				f.dangling = err != nil
+				f.linkToDir = c.dirLinks && err == nil && target.IsDir()
+			}
+			// Dangling links keep their own size.
+			if c.derefSize && osfi.Mode()&os.ModeSymlink != 0 {
+				if target, err := c.stat(path); err == nil {
+					f.lsfi.Size = target.Size()
+				}
+			}
 			if err != nil && path == d {
 				f.err = err
 			}
@@ -115,14 +442,82 @@ func (c cmd) listName(stringer ls.Stringer, d string, prefix bool) error {
 			return filepath.SkipDir
 		}
 
+		if c.recurse && c.limitDepth && f.lsfi.Mode.IsDir() && c.depth(d, path) > c.maxDepth {
+			return filepath.SkipDir
+		}
+
 		return nil
 	})
 
+	if c.glob != "" {
+		files = c.globFilter(files, d)
+	}
+	return files
+}
+
+// sortFiles sorts files by size, time or extension, as requested. Otherwise,
+// files are left in the order they were collected in.
+func (c cmd) sortFiles(files []file) {
 	if c.size {
 		sort.SliceStable(files, func(i, j int) bool {
 			return files[i].lsfi.Size > files[j].lsfi.Size
 		})
+	} else if c.sortTime {
+		sort.SliceStable(files, func(i, j int) bool {
+			return files[i].lsfi.Time(c.timeField).After(files[j].lsfi.Time(c.timeField))
+		})
+	} else if c.sortExt {
+		sort.SliceStable(files, func(i, j int) bool {
+			ni, nj := filepath.Base(files[i].path), filepath.Base(files[j].path)
+			if ei, ej := filepath.Ext(ni), filepath.Ext(nj); ei != ej {
+				return ei < ej
+			}
+			return ni < nj
+		})
 	}
+}
+
+// dotHiddenNames returns the names listed, one per line, in the .hidden file
+// of dir, if there is one.
+func (c cmd) dotHiddenNames(dir string) map[string]bool {
+	var b []byte
+	var err error
+	if name := c.join(dir, ".hidden"); c.fsys == nil {
+		b, err = os.ReadFile(name)
+	} else {
+		b, err = fs.ReadFile(c.fsys, name)
+	}
+	if err != nil {
+		return nil
+	}
+	names := map[string]bool{}
+	for _, line := range strings.Split(string(b), "\n") {
+		if line = strings.TrimSuffix(line, "\r"); line != "" {
+			names[line] = true
+		}
+	}
+	return names
+}
+
+// isDotHidden returns true if path is listed in the .hidden file of its
+// directory and --dot-hidden applies. The .hidden files read are cached in
+// hidden.
+func (c cmd) isDotHidden(hidden map[string]map[string]bool, path string) bool {
+	if !c.dotHidden || c.all {
+		return false
+	}
+	dir := filepath.Dir(path)
+	names, ok := hidden[dir]
+	if !ok {
+		names = c.dotHiddenNames(dir)
+		hidden[dir] = names
+	}
+	return names[filepath.Base(path)]
+}
+
+func (c cmd) listName(stringer ls.Stringer, d string, prefix bool) error {
+	files := c.collect(d)
+	c.sortFiles(files)
 
 	for _, f := range files {
 		if f.err != nil {
@@ -134,29 +529,168 @@ func (c cmd) listName(stringer ls.Stringer, d string, prefix bool) error {
 			f.lsfi.Name = f.path
 		} else if f.path == d {
 			if c.directory {
-				fmt.Fprintln(c.w, stringer.FileString(f.lsfi))
+				c.printLine(stringer.FileString(f.lsfi))
 				continue
 			}
 
 			// Starting directory is a dot when non-recursive
 			if f.osfi.IsDir() {
 				f.lsfi.Name = "."
-				if prefix {
+				if prefix && !c.zero {
+					name := d
 					if c.quoted {
-						fmt.Fprintf(c.w, "%q:\n", d)
-					} else {
-						fmt.Fprintf(c.w, "%v:\n", d)
+						name = fmt.Sprintf("%q", d)
+					}
+					if c.dired {
+						name = diredDirStart + name + diredDirEnd
 					}
+					fmt.Fprintf(c.w, "%s:\n", name)
 				}
 			}
 		}
 
 		c.printFile(stringer, f)
 	}
+	c.flushGrid()
 
 	return nil
 }
 
+// gridSep is the number of spaces between grid columns.
+const gridSep = 2
+
+// gridWidth returns the width of cells laid out down rows rows.
+func gridWidth(cells []string, rows int) int {
+	total := 0
+	for i := 0; i < len(cells); i += rows {
+		w := 0
+		for _, s := range cells[i:min(i+rows, len(cells))] {
+			w = max(w, utf8.RuneCountInString(s))
+		}
+		total += w + gridSep
+	}
+	return total - gridSep
+}
+
+// gridRows returns the number of rows to lay cells out in.
+func (c cmd) gridRows(cells []string) int {
+	if c.columns > 0 {
+		return (len(cells) + c.columns - 1) / c.columns
+	}
+	for rows := 1; rows < len(cells); rows++ {
+		if gridWidth(cells, rows) <= c.width {
+			return rows
+		}
+	}
+	return len(cells)
+}
+
+// flushGrid prints the collected grid cells, if any. tabwriter aligns the
+// columns.
+func (c cmd) flushGrid() {
+	if c.cells == nil || len(*c.cells) == 0 {
+		return
+	}
+	cells := *c.cells
+	*c.cells = nil
+	rows := c.gridRows(cells)
+	for r := 0; r < rows; r++ {
+		var line strings.Builder
+		for i := r; i < len(cells); i += rows {
+			line.WriteString(cells[i])
+			if i+rows < len(cells) {
+				// tabwriter pads by one more space.
+				line.WriteString(strings.Repeat(" ", gridSep-1) + "\t")
+			}
+		}
+		fmt.Fprintln(c.w, line.String())
+	}
+}
+
+// listTree lists d and the tree below it like tree(1): each entry is
+// indented by its depth and connected to its directory with ├── or └──.
+func (c cmd) listTree(stringer ls.Stringer, d string) {
+	var root file
+	children := map[string][]file{}
+	for _, f := range c.collect(d) {
+		if f.path == d {
+			root = f
+			continue
+		}
+		// Also hides everything below hidden directories.
+		if !c.all && strings.HasPrefix(filepath.Base(f.path), ".") {
+			continue
+		}
+		dir := filepath.Dir(f.path)
+		children[dir] = append(children[dir], f)
+	}
+	if root.err != nil {
+		c.printFile(stringer, root)
+		return
+	}
+	// In long form, the connectors get a column of their own, so that
+	// tabwriter still aligns the others.
+	sep := ""
+	if c.long {
+		sep = "\t"
+	}
+	root.lsfi.Name = d
+	fmt.Fprint(c.w, sep)
+	c.printLine(stringer.FileString(root.lsfi))
+
+	var walk func(dir, prefix string)
+	walk = func(dir, prefix string) {
+		entries := children[dir]
+		c.sortFiles(entries)
+		for i, f := range entries {
+			connector, indent := "├── ", "│   "
+			if i == len(entries)-1 {
+				connector, indent = "└── ", "    "
+			}
+			if f.err == nil {
+				f.lsfi.Name = filepath.Base(f.path)
+			}
+			fmt.Fprint(c.w, prefix+connector+sep)
+			c.printFile(stringer, f)
+			walk(filepath.Clean(f.path), prefix+indent)
+		}
+	}
+	walk(filepath.Clean(d), "")
+}
+
+// listMerged lists the entries of all names as one sorted listing, each
+// entry prefixed with the path it was found under.
+func (c cmd) listMerged(stringer ls.Stringer, names []string) {
+	var files []file
+	for _, d := range names {
+		for _, f := range c.collect(d) {
+			if f.err == nil {
+				// The argument itself only shows up when it
+				// is not a directory, or with -d.
+				if f.path == d && f.osfi.IsDir() && !c.directory {
+					continue
+				}
+				if !c.all && strings.HasPrefix(filepath.Base(f.path), ".") && f.path != d {
+					continue
+				}
+				f.lsfi.Name = f.path
+			}
+			files = append(files, f)
+		}
+	}
+	if !c.unsorted {
+		sort.SliceStable(files, func(i, j int) bool {
+			return filepath.Base(files[i].path) < filepath.Base(files[j].path)
+		})
+	}
+	c.sortFiles(files)
+
+	for _, f := range files {
+		c.printFile(stringer, f)
+	}
+	c.flushGrid()
+}
+
 func indicator(fi ls.FileInfo) string {
 	if fi.Mode.IsRegular() && fi.Mode&0o111 != 0 {
 		return "*"
@@ -176,25 +710,172 @@ func indicator(fi ls.FileInfo) string {
 	return ""
 }
 
-func (c cmd) list(names []string) error {
+// classifier returns the -F indicator for f, which is ! for dangling symlinks
+// and @/ for symlinks to directories with --dir-links.
+func classifier(f file) string {
+	if f.dangling {
+		return "!"
+	}
+	if f.linkToDir {
+		return "@/"
+	}
+	return indicator(f.lsfi)
+}
+
+// errNoMatch is returned for glob arguments that match nothing.
+var errNoMatch = errors.New("no matches")
+
+// expandGlobs expands arguments that do not exist but are glob patterns, as
+// a shell would, for shells that do not glob. Patterns that match nothing are
+// dropped from the returned names and reported with errNoMatch.
+func (c cmd) expandGlobs(names []string) ([]string, error) {
+	var expanded []string
+	var errs []error
+	for _, name := range names {
+		if _, err := c.lstat(name); err == nil || !strings.ContainsAny(name, "*?[") {
+			expanded = append(expanded, name)
+			continue
+		}
+		var matches []string
+		var err error
+		if c.fsys == nil {
+			matches, err = filepath.Glob(name)
+		} else {
+			matches, err = fs.Glob(c.fsys, name)
+		}
+		switch {
+		case err != nil:
+			// Not a valid pattern: report the name as missing.
+			expanded = append(expanded, name)
+		case len(matches) == 0:
+			errs = append(errs, fmt.Errorf("%s: %w", name, errNoMatch))
+		default:
+			expanded = append(expanded, matches...)
+		}
+	}
+	return expanded, errors.Join(errs...)
+}
+
+func (c cmd) list(names []string) (err error) {
 	if len(names) == 0 {
 		names = []string{"."}
 	}
-	// Write output in tabular form.
+	names, globErr := c.expandGlobs(names)
+	if len(names) == 0 {
+		return globErr
+	}
+	// The other arguments are still listed.
+	defer func() {
+		if err == nil {
+			err = globErr
+		}
+	}()
+	if c.glob != "" {
+		if _, err := filepath.Match(c.glob, ""); err != nil {
+			return fmt.Errorf("invalid --glob pattern %q: %w", c.glob, err)
+		}
+	}
+	for _, pattern := range c.hide {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid --hide pattern %q: %w", pattern, err)
+		}
+	}
+	if c.printf != "" {
+		if err := ls.CheckFormat(c.printf); err != nil {
+			return fmt.Errorf("invalid --printf format: %w", err)
+		}
+	}
+	if c.timeWord != "" {
+		f, err := ls.ParseTimeField(c.timeWord)
+		if err != nil {
+			return err
+		}
+		c.timeField = f
+	}
+	if c.recurse && c.limitDepth && c.maxDepth == 0 {
+		c.recurse = false
+	}
+	if c.unsortAll {
+		c.all = true
+		c.unsorted = true
+		c.long = false
+		c.size = false
+		c.sortTime = false
+		c.sortExt = false
+	}
+	if c.dired {
+		if c.zero {
+			return errors.New("--dired and --zero are incompatible")
+		}
+		if c.printf != "" {
+			return errors.New("--dired and --printf are incompatible")
+		}
+		c.long = true
+		// The offsets are only known once tabwriter has aligned
+		// the columns, i.e. after it has been flushed below.
+		var buf bytes.Buffer
+		w := c.w
+		c.w = &buf
+		defer func() {
+			if werr := writeDired(w, buf.Bytes(), c.quoted); err == nil {
+				err = werr
+			}
+		}()
+	}
+	// Write output in tabular form, padded with spaces, so that
+	// NUL-terminated entries contain no tabs either.
+	out := c.w
+	if c.zero {
+		out = &nulWriter{w: c.w}
+	}
 	tw := &tabwriter.Writer{}
-	tw.Init(c.w, 0, 0, 1, ' ', 0)
+	tw.Init(out, 0, 0, 1, ' ', 0)
 	c.w = tw
 	defer tw.Flush()
 
 	var s ls.Stringer = ls.NameStringer{}
 	if c.quoted {
 		s = ls.QuotedStringer{}
+	} else if c.zero {
+		s = ls.RawNameStringer{}
+	} else if c.hideControl {
+		s = ls.GraphicNameStringer{}
+	} else if c.showControl {
+		s = ls.RawNameStringer{}
+	}
+	if c.dired {
+		s = diredStringer{Name: s}
 	}
 	if c.long {
-		s = ls.LongStringer{Human: c.human, Name: s}
+		s = ls.LongStringer{Human: c.si, IEC: c.human, Name: s, Octal: c.octal, Context: c.showContext(), Time: c.timeField, Epoch: c.epoch}
+	} else if c.showContext() {
+		s = ls.ContextStringer{Name: s}
+	}
+	if c.printf != "" {
+		s = ls.FormatStringer{Format: c.printf}
+	}
+	if c.decorate != nil {
+		s = ls.DecoratedStringer{Name: s, Decorate: c.decorate}
+	}
+	// Long and NUL-terminated listings have one entry per line.
+	if (c.grid || c.columns > 0) && !c.long && !c.zero {
+		c.cells = new([]string)
+	}
+	if c.tree {
+		c.recurse = true
+		c.cells = nil
+		for _, d := range names {
+			c.listTree(s, d)
+			tw.Flush()
+		}
+		return nil
+	}
+	if c.merge {
+		c.listMerged(s, names)
+		return nil
 	}
 	// Is a name a directory? If so, list it in its own section.
-	prefix := len(names) > 1
+	prefix := len(names) > 1 && !c.noHeaders
 	for _, d := range names {
 		if err := c.listName(s, d, prefix); err != nil {
 			return fmt.Errorf("error while listing %q: %w", d, err)
@@ -204,19 +885,102 @@ func (c cmd) list(names []string) error {
 	return nil
 }
 
+// page writes out to stdout, through $PAGER if stdout is a terminal with
+// fewer rows than out has lines. If stdout is not a terminal, or no pager
+// can be found, out is written directly.
+func page(stdout *os.File, out []byte) error {
+	fd := int(stdout.Fd())
+	if term.IsTerminal(fd) {
+		_, rows, err := term.GetSize(fd)
+		if err == nil && bytes.Count(out, []byte{'\n'}) >= rows {
+			args := strings.Fields(os.Getenv("PAGER"))
+			if len(args) == 0 {
+				args = []string{"more"}
+			}
+			if p, err := exec.LookPath(args[0]); err == nil {
+				pager := exec.Command(p, args[1:]...)
+				pager.Stdin = bytes.NewReader(out)
+				pager.Stdout = stdout
+				pager.Stderr = os.Stderr
+				return pager.Run()
+			}
+		}
+	}
+	_, err := stdout.Write(out)
+	return err
+}
+
 func main() {
 	var c cmd
+	var pager bool
+	var root string
 	flag.BoolVarP(&c.all, "all", "a", false, "show hidden files")
-	flag.BoolVarP(&c.human, "human-readable", "h", false, "human readable sizes")
+	flag.StringVar(&c.glob, "glob", "", "only list entries whose name matches the pattern")
+	flag.StringArrayVar(&c.hide, "hide", nil, "do not list entries matching the pattern, unless -a is given")
+	flag.BoolVarP(&c.noBackups, "ignore-backups", "B", false, "do not list entries ending with ~")
+	flag.BoolVar(&c.dotHidden, "dot-hidden", false, "do not list entries named in their directory's .hidden file, unless -a is given")
+	flag.BoolVarP(&c.human, "human-readable", "h", false, "human readable sizes in powers of 1024")
+	flag.BoolVar(&c.si, "si", false, "human readable sizes in powers of 1000; overrides -h")
 	flag.BoolVarP(&c.directory, "directory", "d", false, "list directories but not their contents")
 	flag.BoolVarP(&c.long, "long", "l", false, "long form")
+	flag.BoolVarP(&c.grid, "vertical", "C", false, "list entries in columns, sorted down the columns")
+	flag.IntVar(&c.columns, "columns", 0, "imply -C, with exactly this many columns")
+	flag.BoolVar(&c.linkTargets, "link-targets", false, "without -l, show symlinks as name -> target")
+	flag.BoolVar(&c.merge, "merge", false, "list the entries of all arguments as one sorted listing, prefixed with their paths")
+	flag.BoolVar(&c.noHeaders, "no-headers", false, "do not print a \"dir:\" header per directory when listing several")
 	flag.BoolVarP(&c.quoted, "quote-name", "Q", false, "quoted")
+	flag.BoolVarP(&c.hideControl, "hide-control-chars", "q", false, "print non-graphic characters in names as ?; the default on a terminal")
+	flag.BoolVar(&c.showControl, "show-control-chars", false, "print names as they are, unless -q is given")
 	flag.BoolVarP(&c.recurse, "recursive", "R", false, "equivalent to findutil's find")
-	flag.BoolVarP(&c.classify, "classify", "F", false, "append indicator (, one of */=>@|) to entries")
+	flag.IntVar(&c.maxDepth, "max-depth", -1, "with -R, descend into at most this many levels of subdirectories below each argument; 0 lists as without -R")
+	flag.BoolVar(&c.tree, "tree", false, "list the tree below each argument with ├──/└── connectors, like tree(1)")
+	flag.BoolVarP(&c.classify, "classify", "F", false, "append indicator (, one of */=>@|) to entries; ! marks dangling symlinks")
+	flag.BoolVar(&c.dirLinks, "dir-links", false, "with -F, mark symlinks to directories with @/")
 	flag.BoolVarP(&c.size, "size", "S", false, "sort by size")
+	flag.BoolVarP(&c.sortTime, "sort-time", "t", false, "sort by time, newest first")
+	flag.BoolVarP(&c.sortExt, "sort-extension", "X", false, "sort by extension, then name")
+	flag.BoolVar(&c.epoch, "epoch", false, "with -l, show times as seconds since the Unix epoch")
+	flag.StringVar(&c.timeWord, "time", "", "show and sort by atime, ctime or mtime (default)")
+	flag.BoolVarP(&c.unsorted, "unsorted", "U", false, "do not sort; list entries in directory order")
+	flag.BoolVarP(&c.unsortAll, "unsorted-all", "f", false, "same as -aU, and disables -l; overrides -S")
+	flag.StringVar(&c.printf, "printf", "", "print each entry as FORMAT: %n name, %s size, %m mode, %a octal permissions, %t mtime, %T mtime in epoch seconds, %% a %")
+	flag.BoolVar(&c.dired, "dired", false, "imply -l and append the byte offsets of names, for Emacs dired")
+	flag.BoolVar(&c.octal, "octal", false, "with -l, also show permissions in octal")
+	flag.BoolVarP(&c.context, "context", "Z", false, "show the SELinux security context of each file")
+	flag.BoolVar(&c.derefSize, "dereference-size", false, "show the size of symlink targets, but the symlink's own type")
+	flag.BoolVar(&c.zero, "zero", false, "end each entry with NUL, not newline, and print names unmodified")
+	flag.StringVar(&root, "root", "", "list names as slash-separated paths in the file system rooted at DIR, resolving symlinks as if DIR were /")
+	flag.BoolVar(&pager, "pager", false, "on a terminal, show listings longer than the screen through $PAGER")
 	c.w = os.Stdout
+	c.decorate = ls.RegisteredDecorator()
 	flag.Parse()
-	if err := c.list(flag.Args()); err != nil {
+	if root != "" {
+		c.fsys = ls.DirFS(root)
+	}
+	c.limitDepth = c.maxDepth >= 0
+	// Names with control characters could garble the terminal.
+	if !c.showControl && term.IsTerminal(int(os.Stdout.Fd())) {
+		c.hideControl = true
+	}
+	c.width = 80
+	if w, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 {
+		c.width = w
+	}
+	if !pager {
+		if err := c.list(flag.Args()); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// The listing has to be complete before we know whether it fits.
+	var buf bytes.Buffer
+	c.w = &buf
+	err := c.list(flag.Args())
+	if perr := page(os.Stdout, buf.Bytes()); perr != nil {
+		log.Print(perr)
+	}
+	if err != nil {
 		log.Fatal(err)
 	}
 }
@@ -46,7 +46,7 @@ func TestListNameLinux(t *testing.T) {
 		s = ls.QuotedStringer{}
 	}
 	if c.long {
-		s = ls.LongStringer{Human: c.human, Name: s}
+		s = ls.LongStringer{IEC: c.human, Name: s}
 	}
 	c.w = &buf
 	_ = c.listName(s, d, false)
@@ -28,9 +28,17 @@ func (c cmd) printFile(stringer ls.Stringer, f file) {
 		if !*final {
 			f.lsfi.Name = f.path
 		}
+		var ind string
 		if c.classify {
-			f.lsfi.Name = f.lsfi.Name + indicator(f.lsfi)
+			ind = classifier(f)
 		}
-		fmt.Fprintln(c.w, stringer.FileString(f.lsfi))
+		if !c.dired {
+			f.lsfi.Name = f.lsfi.Name + ind
+		}
+		s := stringer.FileString(f.lsfi)
+		if c.dired {
+			s = diredClassify(s, ind)
+		}
+		c.printLine(s)
 	}
 }
@@ -10,8 +10,13 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/u-root/u-root/pkg/ls"
 	"golang.org/x/sys/unix"
@@ -110,7 +115,7 @@ func TestListName(t *testing.T) {
 				s = ls.QuotedStringer{}
 			}
 			if tt.flag.long {
-				s = ls.LongStringer{Human: tt.flag.human, Name: s}
+				s = ls.LongStringer{IEC: tt.flag.human, Name: s}
 			}
 			tt.flag.w = &buf
 			if err := tt.flag.listName(s, tt.input, tt.prefix); err != nil {
@@ -256,3 +261,1005 @@ func TestNotExist(t *testing.T) {
 		t.Fatalf("ls of bad name: %q does not contain %q or %q", b.String(), eexist, enoent)
 	}
 }
+
+func TestIgnoreBackups(t *testing.T) {
+	d := t.TempDir()
+	if err := os.Mkdir(filepath.Join(d, "d~"), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "a~", "d~/b"} {
+		if err := os.WriteFile(filepath.Join(d, name), nil, 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		name string
+		c    cmd
+		want string
+	}{
+		{
+			name: "default",
+			want: "a\na~\nd~\n",
+		},
+		{
+			name: "ignore backups",
+			c:    cmd{noBackups: true},
+			want: "a\n",
+		},
+		{
+			name: "ignore backups recursive",
+			c:    cmd{noBackups: true, recurse: true},
+			want: fmt.Sprintf("%s\n%s\n", d, filepath.Join(d, "a")),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.c.w = &buf
+			if err := tt.c.listName(ls.NameStringer{}, d, false); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("listName() = %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestZero(t *testing.T) {
+	d := t.TempDir()
+	for _, name := range []string{"a", "b\nc"} {
+		if err := os.WriteFile(filepath.Join(d, name), nil, 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	c := cmd{w: &buf, zero: true}
+	if err := c.list([]string{d, d}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "a\x00b\nc\x00a\x00b\nc\x00"; buf.String() != want {
+		t.Errorf("list() = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestZeroLong(t *testing.T) {
+	d := t.TempDir()
+	for name, size := range map[string]int{"a": 1, "b": 1000} {
+		if err := os.WriteFile(filepath.Join(d, name), make([]byte, size), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	c := cmd{w: &buf, long: true, zero: true}
+	if err := c.list([]string{d}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if strings.ContainsAny(out, "\t\n") {
+		t.Fatalf("list(-l --zero) = %q, want no tabs or newlines", out)
+	}
+	entries := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	if len(entries) != 2 || !strings.HasSuffix(entries[0], " a") || !strings.HasSuffix(entries[1], " b") {
+		t.Fatalf("list(-l --zero) = %q, want entries for a and b", out)
+	}
+	// The columns are aligned with spaces, so the names line up.
+	if len(entries[0]) != len(entries[1]) {
+		t.Errorf("list(-l --zero) = %q, want aligned columns", out)
+	}
+}
+
+// sizeStringer prints the name and size of a file.
+type sizeStringer struct{}
+
+func (sizeStringer) FileString(fi ls.FileInfo) string {
+	return fmt.Sprintf("%s %d", fi.Name, fi.Size)
+}
+
+func TestDereferenceSize(t *testing.T) {
+	d := t.TempDir()
+	if err := os.WriteFile(filepath.Join(d, "big"), make([]byte, 1000), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("big", filepath.Join(d, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("nowhere", filepath.Join(d, "zdangling")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		c    cmd
+		want string
+	}{
+		{
+			name: "link size",
+			want: "big 1000\nlink 3\nzdangling 7\n",
+		},
+		{
+			name: "target size",
+			c:    cmd{derefSize: true},
+			want: "big 1000\nlink 1000\nzdangling 7\n",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.c.w = &buf
+			if err := tt.c.listName(sizeStringer{}, filepath.Join(d, "big"), false); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range []string{"link", "zdangling"} {
+				if err := tt.c.listName(sizeStringer{}, filepath.Join(d, name), false); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if buf.String() != tt.want {
+				t.Errorf("listName() = %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestUnsortedAll(t *testing.T) {
+	d := t.TempDir()
+	for _, name := range []string{"c", ".b", "a"} {
+		if err := os.WriteFile(filepath.Join(d, name), nil, 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	c := cmd{w: &buf, unsortAll: true, long: true, size: true}
+	if err := c.list([]string{d}); err != nil {
+		t.Fatal(err)
+	}
+	// Directory order is up to the file system.
+	got := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	sort.Strings(got)
+	want := []string{".", ".b", "a", "c"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("list() = %q, want entries %q", buf.String(), want)
+	}
+}
+
+func TestWalkSorted(t *testing.T) {
+	d := t.TempDir()
+	for _, name := range []string{"c", "b", "a"} {
+		if err := os.WriteFile(filepath.Join(d, name), nil, 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got, want []string
+	if err := (cmd{}).walk(d, func(path string, _ os.FileInfo, err error) error {
+		got = append(got, path)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := filepath.Walk(d, func(path string, _ os.FileInfo, err error) error {
+		want = append(want, path)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("walk() visited %q, want %q", got, want)
+	}
+}
+
+func TestNoHeaders(t *testing.T) {
+	d1, d2 := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(d1, "a"), nil, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(d2, "b"), nil, 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		c    cmd
+		want string
+	}{
+		{
+			name: "headers",
+			want: fmt.Sprintf("%s:\na\n%s:\nb\n", d1, d2),
+		},
+		{
+			name: "no headers",
+			c:    cmd{noHeaders: true},
+			want: "a\nb\n",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.c.w = &buf
+			if err := tt.c.list([]string{d1, d2}); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("list() = %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestListFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"bin/sh":       &fstest.MapFile{Data: []byte("#!"), Mode: 0o755},
+		"etc/passwd":   &fstest.MapFile{Data: []byte("root:x:0:0::/:/bin/sh\n")},
+		"etc/.hidden":  &fstest.MapFile{},
+		"init":         &fstest.MapFile{Mode: 0o755},
+		"etc/ssh/keys": &fstest.MapFile{},
+	}
+
+	for _, tt := range []struct {
+		name  string
+		c     cmd
+		names []string
+		want  string
+	}{
+		{
+			name:  "root",
+			names: []string{"."},
+			want:  "bin\netc\ninit\n",
+		},
+		{
+			name:  "subdirectory",
+			c:     cmd{classify: true},
+			names: []string{"etc"},
+			want:  "passwd\nssh/\n",
+		},
+		{
+			name:  "recursive",
+			c:     cmd{recurse: true},
+			names: []string{"etc"},
+			want:  "etc\netc/.hidden\netc/passwd\netc/ssh\netc/ssh/keys\n",
+		},
+		{
+			name:  "file",
+			names: []string{"init"},
+			want:  "init\n",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.c.w = &buf
+			tt.c.fsys = fsys
+			if err := tt.c.list(tt.names); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("list(%q) = %q, want %q", tt.names, buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestGlob(t *testing.T) {
+	d := t.TempDir()
+	if err := os.Mkdir(filepath.Join(d, "sub.go"), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.go", "b.c", "c.go", "sub.go/d.go", "sub.go/e.h"} {
+		if err := os.WriteFile(filepath.Join(d, name), nil, 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		name    string
+		c       cmd
+		want    string
+		wantErr error
+	}{
+		{
+			name: "star",
+			c:    cmd{glob: "*.go"},
+			want: "a.go\nc.go\nsub.go\n",
+		},
+		{
+			name: "class",
+			c:    cmd{glob: "[ab].*"},
+			want: "a.go\nb.c\n",
+		},
+		{
+			name: "question mark recursive",
+			c:    cmd{glob: "?.go", recurse: true},
+			want: fmt.Sprintf("%s\n%s\n%s\n%s\n", d, filepath.Join(d, "a.go"), filepath.Join(d, "c.go"), filepath.Join(d, "sub.go/d.go")),
+		},
+		{
+			name:    "bad pattern",
+			c:       cmd{glob: "[a"},
+			wantErr: filepath.ErrBadPattern,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.c.w = &buf
+			if err := tt.c.list([]string{d}); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("list() = %v, want %v", err, tt.wantErr)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("list() = %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestSortTime(t *testing.T) {
+	d := t.TempDir()
+	for i, name := range []string{"c", "b", "a"} {
+		p := filepath.Join(d, name)
+		if err := os.WriteFile(p, nil, 0o666); err != nil {
+			t.Fatal(err)
+		}
+		// Modification times increase from c to a, access times
+		// the other way round.
+		mtime := time.Date(2000, 1, 1+i, 0, 0, 0, 0, time.UTC)
+		atime := time.Date(2000, 1, 3-i, 0, 0, 0, 0, time.UTC)
+		if err := os.Chtimes(p, atime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		timeWord string
+		want     string
+		wantErr  bool
+	}{
+		{timeWord: "", want: "a\nb\nc\n"},
+		{timeWord: "mtime", want: "a\nb\nc\n"},
+		{timeWord: "atime", want: "c\nb\na\n"},
+		{timeWord: "birth", wantErr: true},
+	} {
+		var buf bytes.Buffer
+		c := cmd{w: &buf, sortTime: true, timeWord: tt.timeWord}
+		err := c.list([]string{d})
+		if gotErr := err != nil; gotErr != tt.wantErr {
+			t.Fatalf("list(--time=%q) = %v, want error %t", tt.timeWord, err, tt.wantErr)
+		}
+		if got := buf.String(); got != tt.want {
+			t.Errorf("list(--time=%q) = %q, want %q", tt.timeWord, got, tt.want)
+		}
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	d := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(d, "a", "b", "c"), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(d, "a", "b", "c", "f"), nil, 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		c    cmd
+		want []string
+		// plain listings print names, not paths.
+		plain bool
+	}{
+		{
+			c:    cmd{recurse: true},
+			want: []string{d, "a", "a/b", "a/b/c", "a/b/c/f"},
+		},
+		{
+			c:     cmd{recurse: true, limitDepth: true, maxDepth: 0},
+			want:  []string{"a"},
+			plain: true,
+		},
+		{
+			c:    cmd{recurse: true, limitDepth: true, maxDepth: 1},
+			want: []string{d, "a", "a/b"},
+		},
+		{
+			c:    cmd{recurse: true, limitDepth: true, maxDepth: 2},
+			want: []string{d, "a", "a/b", "a/b/c"},
+		},
+		{
+			c:    cmd{recurse: true, limitDepth: true, maxDepth: 10},
+			want: []string{d, "a", "a/b", "a/b/c", "a/b/c/f"},
+		},
+	} {
+		var buf bytes.Buffer
+		tt.c.w = &buf
+		if err := tt.c.list([]string{d}); err != nil {
+			t.Fatal(err)
+		}
+		var want []string
+		for _, p := range tt.want {
+			if p != d && !tt.plain {
+				p = filepath.Join(d, p)
+			}
+			want = append(want, p)
+		}
+		if got := strings.Split(strings.TrimSpace(buf.String()), "\n"); !reflect.DeepEqual(got, want) {
+			t.Errorf("list(--max-depth=%d) = %q, want %q", tt.c.maxDepth, got, want)
+		}
+	}
+}
+
+func TestSortExtension(t *testing.T) {
+	d := t.TempDir()
+	for _, name := range []string{"b.go", "a.txt", "Makefile", "a.go", "README"} {
+		if err := os.WriteFile(filepath.Join(d, name), nil, 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	c := cmd{w: &buf, sortExt: true}
+	if err := c.list([]string{d}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "Makefile\nREADME\na.go\nb.go\na.txt\n"; got != want {
+		t.Errorf("list(-X) = %q, want %q", got, want)
+	}
+}
+
+func TestHide(t *testing.T) {
+	d := t.TempDir()
+	for _, name := range []string{"a.c", "a.o", "b.o", "c.a"} {
+		if err := os.WriteFile(filepath.Join(d, name), nil, 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		name    string
+		c       cmd
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "one pattern",
+			c:    cmd{hide: []string{"*.o"}},
+			want: "a.c\nc.a\n",
+		},
+		{
+			name: "several patterns",
+			c:    cmd{hide: []string{"*.o", "a.*"}},
+			want: "c.a\n",
+		},
+		{
+			name: "overridden by -a",
+			c:    cmd{hide: []string{"*.o"}, all: true},
+			want: ".\na.c\na.o\nb.o\nc.a\n",
+		},
+		{
+			name:    "bad pattern",
+			c:       cmd{hide: []string{"["}},
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.c.w = &buf
+			err := tt.c.list([]string{d})
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Fatalf("list() = %v, want error %t", err, tt.wantErr)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("list() = %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestDanglingSymlink(t *testing.T) {
+	d := t.TempDir()
+	if err := os.WriteFile(filepath.Join(d, "target"), nil, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("target", filepath.Join(d, "good")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("missing", filepath.Join(d, "bad")); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	c := cmd{w: &buf, classify: true}
+	if err := c.list([]string{d}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "bad!\ngood@\ntarget\n"; got != want {
+		t.Errorf("list(-F) = %q, want %q", got, want)
+	}
+}
+
+func TestLinkTargets(t *testing.T) {
+	d := t.TempDir()
+	if err := os.WriteFile(filepath.Join(d, "target"), nil, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("target", filepath.Join(d, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("missing", filepath.Join(d, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	c := cmd{w: &buf, linkTargets: true}
+	if err := c.list([]string{d}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "dangling -> missing\nlink -> target\ntarget\n"; got != want {
+		t.Errorf("list(--link-targets) = %q, want %q", got, want)
+	}
+}
+
+func TestListDirFS(t *testing.T) {
+	d := t.TempDir()
+	if err := os.WriteFile(filepath.Join(d, "target"), nil, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{
+		"link": "target",
+		// d exists on the host, but not inside d.
+		"abs": d,
+		// .. stops at the root.
+		"up": "../../target",
+	} {
+		if err := os.Symlink(target, filepath.Join(d, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The names are relative to d, not to the current directory, so any
+	// host lookup of them fails.
+	var buf bytes.Buffer
+	c := cmd{w: &buf, fsys: ls.DirFS(d), linkTargets: true, classify: true, context: true}
+	if err := c.list([]string{"."}); err != nil {
+		t.Fatal(err)
+	}
+	want := "abs! -> " + d + "\nlink@ -> target\ntarget\nup@ -> ../../target\n"
+	if got := buf.String(); got != want {
+		t.Errorf("list(--root) = %q, want %q", got, want)
+	}
+}
+
+func TestDecorate(t *testing.T) {
+	d := t.TempDir()
+	for _, name := range []string{"clean", "dirty"} {
+		if err := os.WriteFile(filepath.Join(d, name), nil, 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	c := cmd{w: &buf, decorate: func(fi ls.FileInfo) (string, string) {
+		if fi.Name == "dirty" {
+			return "M ", " *"
+		}
+		return "  ", ""
+	}}
+	if err := c.list([]string{d}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "  clean\nM dirty *\n"; got != want {
+		t.Errorf("list() = %q, want %q", got, want)
+	}
+}
+
+func TestPageNotTerminal(t *testing.T) {
+	// A pager that would visibly change the output must not run when
+	// stdout is not a terminal.
+	t.Setenv("PAGER", "sed s/^/paged/")
+	f, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	want := strings.Repeat("entry\n", 1000)
+	if err := page(f, []byte(want)); err != nil {
+		t.Fatalf("page() = %v", err)
+	}
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("page() wrote %d bytes through the pager, want the listing unchanged", len(got))
+	}
+}
+
+func TestDirLinks(t *testing.T) {
+	d := t.TempDir()
+	if err := os.Mkdir(filepath.Join(d, "dir"), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(d, "file"), nil, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range []struct{ name, target string }{
+		{"dirlink", "dir"},
+		{"filelink", "file"},
+		{"dangling", "missing"},
+	} {
+		if err := os.Symlink(l.target, filepath.Join(d, l.name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		dirLinks bool
+		want     string
+	}{
+		{false, "dangling!\ndir/\ndirlink@\nfile\nfilelink@\n"},
+		{true, "dangling!\ndir/\ndirlink@/\nfile\nfilelink@\n"},
+	} {
+		var buf bytes.Buffer
+		c := cmd{w: &buf, classify: true, dirLinks: tt.dirLinks}
+		if err := c.list([]string{d}); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != tt.want {
+			t.Errorf("list(-F, dirLinks=%t) = %q, want %q", tt.dirLinks, got, tt.want)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	d := t.TempDir()
+	for _, name := range []string{"a/zeta", "a/beta", "a/.hidden", "b/alpha", "b/beta", "c"} {
+		p := filepath.Join(d, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, b, c := filepath.Join(d, "a"), filepath.Join(d, "b"), filepath.Join(d, "c")
+
+	var buf bytes.Buffer
+	cm := cmd{w: &buf, merge: true}
+	if err := cm.list([]string{a, b, c}); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		filepath.Join(b, "alpha"),
+		filepath.Join(a, "beta"),
+		filepath.Join(b, "beta"),
+		c,
+		filepath.Join(a, "zeta"),
+	}, "\n") + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("list(--merge) = %q, want %q", got, want)
+	}
+}
+
+func TestControlChars(t *testing.T) {
+	d := t.TempDir()
+	if err := os.WriteFile(filepath.Join(d, "a\x01b\u202ec"), nil, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name string
+		c    cmd
+		want string
+	}{
+		{name: "default", want: "a?b\u202ec\n"},
+		{name: "hide", c: cmd{hideControl: true}, want: "a?b?c\n"},
+		{name: "show", c: cmd{showControl: true}, want: "a\x01b\u202ec\n"},
+		{name: "hide wins", c: cmd{hideControl: true, showControl: true}, want: "a?b?c\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.c.w = &buf
+			if err := tt.c.list([]string{d}); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("list() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDired(t *testing.T) {
+	d := t.TempDir()
+	d1, d2 := filepath.Join(d, "one"), filepath.Join(d, "two")
+	for _, name := range []string{"one/a", "one/long name", "two/b"} {
+		p := filepath.Join(d, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("a", filepath.Join(d1, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	// offsets returns the strings out[start:end] for the offsets listed
+	// on the line of out starting with prefix.
+	offsets := func(out, prefix string) []string {
+		var spans []string
+		for _, line := range strings.Split(out, "\n") {
+			f, ok := strings.CutPrefix(line, prefix+" ")
+			if !ok {
+				continue
+			}
+			nums := strings.Fields(f)
+			if len(nums)%2 != 0 {
+				t.Fatalf("%s has an odd number of offsets: %q", prefix, line)
+			}
+			for i := 0; i < len(nums); i += 2 {
+				start, err1 := strconv.Atoi(nums[i])
+				end, err2 := strconv.Atoi(nums[i+1])
+				if err1 != nil || err2 != nil || start > end || end > len(out) {
+					t.Fatalf("bad offsets %q in %q", nums[i:i+2], line)
+				}
+				spans = append(spans, out[start:end])
+			}
+		}
+		return spans
+	}
+
+	var buf bytes.Buffer
+	c := cmd{w: &buf, dired: true}
+	if err := c.list([]string{d1, d2}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) < 3 || lines[len(lines)-1] != "//DIRED-OPTIONS// --quoting-style=literal" {
+		t.Fatalf("list(--dired) = %q, want it to end with the dired options", out)
+	}
+	for _, line := range lines {
+		if line != "" && !strings.HasPrefix(line, "  ") && !strings.HasPrefix(line, "//") {
+			t.Errorf("line %q is not indented", line)
+		}
+	}
+	if got, want := offsets(out, "//DIRED//"), []string{"a", "link", "long name", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("//DIRED// names = %q, want %q", got, want)
+	}
+	if got, want := offsets(out, "//SUBDIRED//"), []string{d1, d2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("//SUBDIRED// names = %q, want %q", got, want)
+	}
+	if strings.Contains(out, "\x00") {
+		t.Errorf("list(--dired) = %q contains markers", out)
+	}
+
+	// The -F indicator follows the name but is not part of its span.
+	buf.Reset()
+	c = cmd{w: &buf, dired: true, classify: true}
+	if err := c.list([]string{d1}); err != nil {
+		t.Fatal(err)
+	}
+	out = buf.String()
+	if got, want := offsets(out, "//DIRED//"), []string{"a", "link", "long name"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("//DIRED// names with -F = %q, want %q", got, want)
+	}
+	if !strings.Contains(out, " link@ -> a\n") {
+		t.Errorf("list(--dired -F) = %q, want the indicator after link", out)
+	}
+
+	c = cmd{w: &bytes.Buffer{}, dired: true, zero: true}
+	if err := c.list([]string{d1}); err == nil {
+		t.Errorf("list(--dired --zero) = nil, want error")
+	}
+}
+
+func TestPrintf(t *testing.T) {
+	d := t.TempDir()
+	if err := os.WriteFile(filepath.Join(d, "small"), []byte("12"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(d, "large"), make([]byte, 1000), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(d, "small"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	c := cmd{w: &buf, printf: "%s %a %n 100%%", size: true, long: true}
+	if err := c.list([]string{d}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "1000 0600 large 100%\n2 0640 small 100%\n"; got != want {
+		t.Errorf("list(--printf) = %q, want %q", got, want)
+	}
+
+	c = cmd{w: &buf, printf: "%n %z"}
+	if err := c.list([]string{d}); err == nil {
+		t.Errorf("list(--printf=%q) = nil, want error", c.printf)
+	}
+}
+
+func TestDotHidden(t *testing.T) {
+	d := t.TempDir()
+	for _, name := range []string{"keep", "secret", "sub/inner", "sub/other"} {
+		p := filepath.Join(d, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(d, ".hidden"), []byte("secret\nmissing\n\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(d, "sub", ".hidden"), []byte("inner\r\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		c    cmd
+		want []string
+	}{
+		{name: "off", want: []string{"keep", "secret", "sub"}},
+		{name: "on", c: cmd{dotHidden: true}, want: []string{"keep", "sub"}},
+		{name: "all", c: cmd{dotHidden: true, all: true}, want: []string{".", ".hidden", "keep", "secret", "sub"}},
+		{
+			name: "recursive",
+			c:    cmd{dotHidden: true, recurse: true},
+			want: []string{
+				d,
+				filepath.Join(d, ".hidden"),
+				filepath.Join(d, "keep"),
+				filepath.Join(d, "sub"),
+				filepath.Join(d, "sub", ".hidden"),
+				filepath.Join(d, "sub", "other"),
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.c.w = &buf
+			if err := tt.c.list([]string{d}); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := buf.String(), strings.Join(tt.want, "\n")+"\n"; got != want {
+				t.Errorf("list() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestGrid(t *testing.T) {
+	d := t.TempDir()
+	for _, name := range []string{"a", "bb", "c", "dd", "e", "f", "g"} {
+		if err := os.WriteFile(filepath.Join(d, name), nil, 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		name string
+		c    cmd
+		want string
+	}{
+		{name: "fits in one row", c: cmd{grid: true, width: 80}, want: "a  bb  c  dd  e  f  g\n"},
+		{name: "narrow", c: cmd{grid: true, width: 10}, want: "a   dd  g\nbb  e\nc   f\n"},
+		{name: "columns", c: cmd{columns: 3, width: 80}, want: "a   dd  g\nbb  e\nc   f\n"},
+		{name: "columns overflow", c: cmd{columns: 7, width: 4}, want: "a  bb  c  dd  e  f  g\n"},
+		{name: "long", c: cmd{columns: 3, long: true, printf: "%n"}, want: "a\nbb\nc\ndd\ne\nf\ng\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.c.w = &buf
+			if err := tt.c.list([]string{d}); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("list() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandGlobs(t *testing.T) {
+	d := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.go", "[x"} {
+		if err := os.WriteFile(filepath.Join(d, name), nil, 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr error
+	}{
+		{name: "matches", args: []string{"*.txt"}, want: "a.txt\nb.txt\n"},
+		{name: "existing name is not a pattern", args: []string{"[x"}, want: "[x\n"},
+		{name: "no match", args: []string{"*.md"}, wantErr: errNoMatch},
+		{name: "no match among others", args: []string{"*.md", "c.go"}, want: "c.go\n", wantErr: errNoMatch},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var args []string
+			for _, arg := range tt.args {
+				args = append(args, filepath.Join(d, arg))
+			}
+			var buf bytes.Buffer
+			c := cmd{w: &buf}
+			if err := c.list(args); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("list(%q) = %v, want %v", args, err, tt.wantErr)
+			}
+			if got := strings.ReplaceAll(buf.String(), d+string(filepath.Separator), ""); got != tt.want {
+				t.Errorf("list(%q) printed %q, want %q", args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTree(t *testing.T) {
+	d := t.TempDir()
+	for _, name := range []string{"a/x", "a/.h", "a/sub/y", "b", ".hid/z", "c"} {
+		p := filepath.Join(d, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(d, ".hidden"), []byte("c\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		c    cmd
+		want string
+	}{
+		{
+			name: "default",
+			c:    cmd{tree: true},
+			want: `├── a
+│   ├── sub
+│   │   └── y
+│   └── x
+├── b
+└── c
+`,
+		},
+		{
+			name: "all",
+			c:    cmd{tree: true, all: true},
+			want: `├── .hid
+│   └── z
+├── .hidden
+├── a
+│   ├── .h
+│   ├── sub
+│   │   └── y
+│   └── x
+├── b
+└── c
+`,
+		},
+		{
+			name: "max depth and dot-hidden",
+			c:    cmd{tree: true, limitDepth: true, maxDepth: 0, dotHidden: true, classify: true},
+			want: `├── a/
+└── b
+`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.c.w = &buf
+			if err := tt.c.list([]string{d}); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := buf.String(), d+"\n"+tt.want; got != want {
+				t.Errorf("list() =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
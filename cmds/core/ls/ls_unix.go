@@ -9,6 +9,7 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/u-root/u-root/pkg/ls"
@@ -22,9 +23,21 @@ func (c cmd) printFile(stringer ls.Stringer, f file) {
 	// Hide .files unless -a was given
 	if c.all || !strings.HasPrefix(f.lsfi.Name, ".") {
 		// Print the file in the proper format.
+		var ind string
 		if c.classify {
-			f.lsfi.Name = f.lsfi.Name + indicator(f.lsfi)
+			ind = classifier(f)
 		}
-		fmt.Fprintln(c.w, stringer.FileString(f.lsfi))
+		if !c.dired {
+			f.lsfi.Name = f.lsfi.Name + ind
+		}
+		s := stringer.FileString(f.lsfi)
+		if c.dired {
+			s = diredClassify(s, ind)
+		}
+		// In long mode, the stringer already shows the target.
+		if c.linkTargets && !c.long && f.lsfi.Mode&os.ModeSymlink != 0 {
+			s += " -> " + f.lsfi.SymlinkTarget
+		}
+		c.printLine(s)
 	}
 }
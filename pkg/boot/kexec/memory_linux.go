@@ -162,6 +162,40 @@ func (rs Ranges) Minus(r Range) Ranges {
 	return ram
 }
 
+// Overlaps returns true if r overlaps with any range in rs.
+func (rs Ranges) Overlaps(r Range) bool {
+	for _, r2 := range rs {
+		if r2.Overlaps(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// TotalSize returns the number of points covered by rs.
+//
+// Points covered by more than one range are only counted once, so the result
+// is correct even if rs is not a list of non-overlapping ranges.
+func (rs Ranges) TotalSize() uint64 {
+	sorted := append(Ranges(nil), rs...)
+	sorted.Sort()
+
+	var total uint64
+	// end is the exclusive end of everything counted so far.
+	var end uintptr
+	for i, r := range sorted {
+		start := r.Start
+		if i > 0 && start < end {
+			start = end
+		}
+		if r.End() > start {
+			total += uint64(r.End() - start)
+			end = r.End()
+		}
+	}
+	return total
+}
+
 // MaxAddr is the highest address in a 64bit address space.
 const MaxAddr = ^uintptr(0)
 
@@ -181,6 +215,7 @@ type findSpaceOptions struct {
 	limit      Range
 	size       uint
 	startAlign uint
+	exclude    Ranges
 }
 
 // FindOptioner is a config option for FindSpace.
@@ -219,6 +254,18 @@ func WithStartAlignment(alignSize uint) FindOptioner {
 	}
 }
 
+// WithoutRanges requires FindSpace to return a range that does not overlap
+// with any of the excluded ranges.
+//
+// This is useful to place several segments in a row before any of them have
+// been added to the memory map: pass the ranges returned by earlier FindSpace
+// calls to avoid handing out the same space twice.
+func WithoutRanges(excluded ...Range) FindOptioner {
+	return func(o *findSpaceOptions) {
+		o.exclude = append(o.exclude, excluded...)
+	}
+}
+
 // FindSpace finds a continuous piece of sz points within Ranges and the given
 // options and returns the Range pointing to it.
 func (rs Ranges) FindSpace(sz uint, opts ...FindOptioner) (Range, error) {
@@ -232,6 +279,9 @@ func (rs Ranges) FindSpace(sz uint, opts ...FindOptioner) (Range, error) {
 	if o.startAlign != 0 && !align.IsAligned(o.limit.Start, uintptr(o.startAlign)) {
 		o.limit = o.limit.WithStart(align.Up(o.limit.Start, uintptr(o.startAlign)))
 	}
+	for _, e := range o.exclude {
+		rs = rs.Minus(e)
+	}
 	for _, r := range rs {
 		if o.startAlign != 0 && !align.IsAligned(r.Start, uintptr(o.startAlign)) {
 			r = r.WithStart(align.Up(r.Start, uintptr(o.startAlign)))
@@ -555,6 +605,11 @@ type Memory struct {
 	//
 	// Each segment also contains a physical memory region it maps to.
 	Segments Segments
+
+	// UsableTypes are the range types of Phys that AvailableRAM places
+	// segments in. If empty, only RangeRAM is used; set it to e.g.
+	// DefaultUsableTypes() to also use RangeDefault regions.
+	UsableTypes []RangeType
 }
 
 // LoadElfSegments loads loadable ELF segments.
@@ -662,8 +717,9 @@ func (m *Memory) AddKexecSegmentExplicit(d []byte, sz, offset, alignSizeBytes ui
 
 // AvailableRAM returns page-aligned unused regions of RAM.
 //
-// AvailableRAM takes all RAM-marked pages in the memory map and subtracts the
-// kexec segments already allocated. RAM segments begin at a page boundary.
+// AvailableRAM takes all pages in the memory map of UsableTypes, or of type
+// RangeRAM if UsableTypes is empty, and subtracts the kexec segments already
+// allocated. RAM segments begin at a page boundary.
 //
 // E.g if page size is 4K and RAM segments are
 //
@@ -677,7 +733,11 @@ func (m *Memory) AddKexecSegmentExplicit(d []byte, sz, offset, alignSizeBytes ui
 //
 //	[{start:0 size:40} {start:4096 end:8000 - 4096}]
 func (m Memory) AvailableRAM() Ranges {
-	ram := m.Phys.RAM()
+	types := m.UsableTypes
+	if len(types) == 0 {
+		types = []RangeType{RangeRAM}
+	}
+	ram := m.Phys.UsableRAM(types...)
 
 	// Remove all points we've already reserved from available RAM.
 	for _, s := range m.Segments {
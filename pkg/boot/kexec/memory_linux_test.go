@@ -509,6 +509,37 @@ func TestFindSpace(t *testing.T) {
 			opts: []FindOptioner{WithinRange(RangeFromInterval(0x500, MaxAddr)), WithAlignment(0x1000)},
 			want: Range{Start: 0x3000, Size: 0x1000},
 		},
+		{
+			name: "excluded earlier placement",
+			rs: Ranges{
+				Range{Start: 0x0, Size: 0x1000},
+			},
+			size: 0x400,
+			opts: []FindOptioner{WithoutRanges(Range{Start: 0x0, Size: 0x400})},
+			want: Range{Start: 0x400, Size: 0x400},
+		},
+		{
+			name: "excluded several placements with alignment",
+			rs: Ranges{
+				Range{Start: 0x0, Size: 0x3000},
+			},
+			size: 0x800,
+			opts: []FindOptioner{
+				WithoutRanges(Range{Start: 0x0, Size: 0x800}),
+				WithoutRanges(Range{Start: 0x1000, Size: 0x10}),
+				WithAlignment(0x1000),
+			},
+			want: Range{Start: 0x2000, Size: 0x1000},
+		},
+		{
+			name: "everything excluded",
+			rs: Ranges{
+				Range{Start: 0x0, Size: 0x1000},
+			},
+			size: 0x10,
+			opts: []FindOptioner{WithoutRanges(Range{Start: 0x0, Size: 0x1000})},
+			err:  ErrNotEnoughSpace,
+		},
 	} {
 		t.Run(fmt.Sprintf("test_%d_%s", i, tt.name), func(t *testing.T) {
 			got, err := tt.rs.FindSpace(tt.size, tt.opts...)
@@ -947,6 +978,99 @@ func TestRanges(t *testing.T) {
 	}
 }
 
+func TestRangesOverlaps(t *testing.T) {
+	rs := Ranges{
+		Range{Start: 0x1000, Size: 0x1000},
+		Range{Start: 0x4000, Size: 0x1000},
+	}
+	for _, tt := range []struct {
+		r    Range
+		want bool
+	}{
+		{r: Range{Start: 0, Size: 0x1000}, want: false},
+		{r: Range{Start: 0, Size: 0x1001}, want: true},
+		{r: Range{Start: 0x2000, Size: 0x2000}, want: false},
+		{r: Range{Start: 0x3000, Size: 0x3000}, want: true},
+	} {
+		if got := rs.Overlaps(tt.r); got != tt.want {
+			t.Errorf("%v.Overlaps(%v) = %t, want %t", rs, tt.r, got, tt.want)
+		}
+	}
+}
+
+// TestInclusiveConversions pins the conventions used to convert between the
+// inclusive ends used by firmware and the kernel and Range's exclusive end.
+func TestInclusiveConversions(t *testing.T) {
+	for _, tt := range []struct {
+		r    Range
+		last uintptr
+		end  uintptr
+	}{
+		{r: Range{Start: 0x100, Size: 0x100}, last: 0x1ff, end: 0x200},
+		{r: Range{Start: 0, Size: 1}, last: 0, end: 1},
+		{r: Range{Start: 0x1000, Size: uint(MaxAddr - 0x1000 + 1)}, last: MaxAddr, end: 0},
+	} {
+		if got := tt.r.Last(); got != tt.last {
+			t.Errorf("%v.Last() = %#x, want %#x", tt.r, got, tt.last)
+		}
+		if got := tt.r.End(); got != tt.end {
+			t.Errorf("%v.End() = %#x, want %#x", tt.r, got, tt.end)
+		}
+		if got := RangeFromInclusiveInterval(tt.r.Start, tt.r.Last()); got != tt.r {
+			t.Errorf("RangeFromInclusiveInterval(%#x, %#x) = %v, want %v", tt.r.Start, tt.r.Last(), got, tt.r)
+		}
+	}
+}
+
+func TestRangesTotalSize(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		rs   Ranges
+		want uint64
+	}{
+		{name: "empty", rs: nil, want: 0},
+		{
+			name: "disjunct",
+			rs: Ranges{
+				Range{Start: 0x2000, Size: 0x1000},
+				Range{Start: 0x0, Size: 0x1000},
+			},
+			want: 0x2000,
+		},
+		{
+			name: "adjacent",
+			rs: Ranges{
+				Range{Start: 0x0, Size: 0x1000},
+				Range{Start: 0x1000, Size: 0x1000},
+			},
+			want: 0x2000,
+		},
+		{
+			name: "overlapping counted once",
+			rs: Ranges{
+				Range{Start: 0x0, Size: 0x1800},
+				Range{Start: 0x1000, Size: 0x1000},
+			},
+			want: 0x2000,
+		},
+		{
+			name: "contained counted once",
+			rs: Ranges{
+				Range{Start: 0x0, Size: 0x3000},
+				Range{Start: 0x1000, Size: 0x1000},
+				Range{Start: 0x4000, Size: 0x10},
+			},
+			want: 0x3010,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rs.TotalSize(); got != tt.want {
+				t.Errorf("%v.TotalSize() = %#x, want %#x", tt.rs, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestAlign(t *testing.T) {
 	for _, tt := range []struct {
 		r         Range
@@ -0,0 +1,181 @@
+// Copyright 2026 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kexec
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// parseMemSize parses a size or address the way the kernel's memparse does:
+// a number in C notation (0x prefix for hex, 0 for octal), optionally
+// followed by one of the K, M, G, T, P, E suffixes.
+//
+// As in the kernel, the number is consumed first, so that e.g. the e of 0x1e
+// is a hex digit, not the exa suffix.
+func parseMemSize(s string) (uint64, error) {
+	digits, base := s, 10
+	switch {
+	case len(s) > 2 && (s[:2] == "0x" || s[:2] == "0X"):
+		digits, base = s[2:], 16
+	case len(s) > 1 && s[0] == '0':
+		digits, base = s[1:], 8
+	}
+	n := strings.IndexFunc(digits, func(r rune) bool {
+		d := strings.IndexRune("0123456789abcdef", unicode.ToLower(r))
+		return d == -1 || d >= base
+	})
+	if n == -1 {
+		n = len(digits)
+	}
+	number, suffix := digits[:n], digits[n:]
+	if number == "" && base != 8 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	var v uint64
+	if number != "" {
+		var err error
+		if v, err = strconv.ParseUint(number, base, 64); err != nil {
+			return 0, err
+		}
+	}
+
+	var shift uint
+	switch suffix {
+	case "":
+	case "K", "k":
+		shift = 10
+	case "M", "m":
+		shift = 20
+	case "G", "g":
+		shift = 30
+	case "T", "t":
+		shift = 40
+	case "P", "p":
+		shift = 50
+	case "E", "e":
+		shift = 60
+	default:
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	if v<<shift>>shift != v {
+		return 0, fmt.Errorf("size %s overflows", s)
+	}
+	return v << shift, nil
+}
+
+// memmapTypes maps the memmap= delimiter between size and start address to
+// the type of range it creates.
+var memmapTypes = map[byte]RangeType{
+	'@': RangeRAM,
+	'#': RangeACPI,
+	'$': RangeReserved,
+	'!': RangePersistentLegacy,
+}
+
+// capRAM removes all RAM at or above limit from the memory map.
+//
+// Ranges of other types are left alone, just like the kernel's mem= handling.
+func (mm *MemoryMap) capRAM(limit uintptr) {
+	var newMap MemoryMap
+	for _, tr := range *mm {
+		switch {
+		case tr.Type != RangeRAM || tr.End() <= limit:
+			newMap = append(newMap, tr)
+		case tr.Start < limit:
+			newMap = append(newMap, TypedRange{Range: RangeFromInterval(tr.Start, limit), Type: RangeRAM})
+		}
+	}
+	*mm = newMap
+}
+
+// applyMemmap applies a single memmap= entry, e.g. 64K$0x18690000.
+func (mm *MemoryMap) applyMemmap(entry string) error {
+	if entry == "exactmap" {
+		*mm = nil
+		return nil
+	}
+	// memmap=nn%ss-oldtype+newtype changes the type of ranges already in
+	// the kernel's map, which kexec's RangeTypes cannot express.
+	if strings.Contains(entry, "%") {
+		log.Printf("Ignoring unsupported type update memmap=%s", entry)
+		return nil
+	}
+
+	i := strings.IndexAny(entry, "@#$!")
+	if i == -1 {
+		// memmap=nn is the same as mem=nn.
+		limit, err := parseMemSize(entry)
+		if err != nil {
+			return fmt.Errorf("invalid memmap=%s: %w", entry, err)
+		}
+		mm.capRAM(uintptr(limit))
+		return nil
+	}
+
+	size, err := parseMemSize(entry[:i])
+	if err != nil {
+		return fmt.Errorf("invalid memmap=%s: %w", entry, err)
+	}
+	start, err := parseMemSize(entry[i+1:])
+	if err != nil {
+		return fmt.Errorf("invalid memmap=%s: %w", entry, err)
+	}
+	if size == 0 {
+		return nil
+	}
+	mm.InsertType(uintptr(start), uint(size), memmapTypes[entry[i]])
+	return nil
+}
+
+// ApplyKernelCmdline applies the memmap= and mem= overrides found in the
+// kernel command line cmdline to mm, yielding the memory map the kernel
+// booted with cmdline actually uses.
+//
+// Supported forms are
+//
+//	mem=nn[KMG]          remove all RAM at or above nn
+//	memmap=nn[KMG]       same as mem=nn
+//	memmap=exactmap      discard the firmware map; only memmap= entries count
+//	memmap=nn[KMG]@ss    mark [ss, ss+nn) as RAM
+//	memmap=nn[KMG]#ss    mark [ss, ss+nn) as ACPI tables
+//	memmap=nn[KMG]$ss    mark [ss, ss+nn) as reserved
+//	memmap=nn[KMG]!ss    mark [ss, ss+nn) as persistent memory
+//
+// Several memmap= entries may be given as a comma-separated list. Parameters
+// are applied in the order they appear, as the kernel does. The type update
+// form memmap=nn[KMG]%ss[KMG]-oldtype+newtype is not supported; it is logged
+// and skipped, and the other parameters still apply.
+func (mm *MemoryMap) ApplyKernelCmdline(cmdline string) error {
+	for _, param := range strings.Fields(cmdline) {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "mem":
+			// mem=nopentium is an x86-32 paging option, not a limit.
+			if value == "nopentium" {
+				continue
+			}
+			limit, err := parseMemSize(value)
+			if err != nil {
+				return fmt.Errorf("invalid mem=%s: %w", value, err)
+			}
+			mm.capRAM(uintptr(limit))
+
+		case "memmap":
+			for _, entry := range strings.Split(value, ",") {
+				if err := mm.applyMemmap(entry); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
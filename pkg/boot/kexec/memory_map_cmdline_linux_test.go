@@ -0,0 +1,128 @@
+// Copyright 2026 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kexec
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyKernelCmdline(t *testing.T) {
+	firmware := MemoryMap{
+		TypedRange{Range: Range{Start: 0, Size: 0x9f000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x9f000, Size: 0x61000}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 0x100000, Size: 0x7ff00000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x80000000, Size: 0x1000}, Type: RangeACPI},
+		TypedRange{Range: Range{Start: 0xc0000000, Size: 0x20000000}, Type: RangeRAM},
+	}
+
+	for _, tt := range []struct {
+		name    string
+		cmdline string
+		want    MemoryMap
+		wantErr bool
+	}{
+		{
+			name:    "no overrides",
+			cmdline: "console=ttyS0 root=/dev/sda1",
+			want:    firmware,
+		},
+		{
+			name:    "mem caps RAM",
+			cmdline: "mem=1G",
+			want: MemoryMap{
+				TypedRange{Range: Range{Start: 0, Size: 0x9f000}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0x9f000, Size: 0x61000}, Type: RangeReserved},
+				TypedRange{Range: Range{Start: 0x100000, Size: 0x3ff00000}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0x80000000, Size: 0x1000}, Type: RangeACPI},
+			},
+		},
+		{
+			name:    "memmap without address is mem",
+			cmdline: "memmap=0xc0000000",
+			want:    firmware[:4],
+		},
+		{
+			name:    "memmap reserves",
+			cmdline: "memmap=64K$0x200000",
+			want: MemoryMap{
+				TypedRange{Range: Range{Start: 0, Size: 0x9f000}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0x9f000, Size: 0x61000}, Type: RangeReserved},
+				TypedRange{Range: Range{Start: 0x100000, Size: 0x100000}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0x200000, Size: 0x10000}, Type: RangeReserved},
+				TypedRange{Range: Range{Start: 0x210000, Size: 0x7fdf0000}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0x80000000, Size: 0x1000}, Type: RangeACPI},
+				TypedRange{Range: Range{Start: 0xc0000000, Size: 0x20000000}, Type: RangeRAM},
+			},
+		},
+		{
+			name:    "memmap type update is skipped",
+			cmdline: "memmap=64K%0x200000-1+2 memmap=0xc0000000",
+			want:    firmware[:4],
+		},
+		{
+			name:    "exactmap",
+			cmdline: "memmap=exactmap memmap=640K@0,1M#0x100000 memmap=4M!0x200000",
+			want: MemoryMap{
+				TypedRange{Range: Range{Start: 0, Size: 0xa0000}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0x100000, Size: 0x100000}, Type: RangeACPI},
+				TypedRange{Range: Range{Start: 0x200000, Size: 0x400000}, Type: RangePersistentLegacy},
+			},
+		},
+		{
+			name:    "bad size",
+			cmdline: "mem=12Q",
+			wantErr: true,
+		},
+		{
+			name:    "bad memmap address",
+			cmdline: "memmap=64K$foo",
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mm := append(MemoryMap(nil), firmware...)
+			err := mm.ApplyKernelCmdline(tt.cmdline)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Fatalf("ApplyKernelCmdline(%q) = %v, want error %t", tt.cmdline, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(mm, tt.want) {
+				t.Errorf("ApplyKernelCmdline(%q) =\n%v, want\n%v", tt.cmdline, mm, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMemSize(t *testing.T) {
+	for _, tt := range []struct {
+		s       string
+		want    uint64
+		wantErr bool
+	}{
+		{s: "4096", want: 4096},
+		{s: "64K", want: 64 << 10},
+		{s: "1G", want: 1 << 30},
+		{s: "0x1000", want: 0x1000},
+		{s: "0x1e", want: 0x1e},
+		{s: "0XFEE", want: 0xfee},
+		{s: "0x1eM", want: 0x1e << 20},
+		{s: "2E", want: 2 << 60},
+		{s: "010", want: 8},
+		{s: "0", want: 0},
+		{s: "", wantErr: true},
+		{s: "0x", wantErr: true},
+		{s: "12Q", wantErr: true},
+		{s: "1KK", wantErr: true},
+		{s: "16E", wantErr: true},
+	} {
+		got, err := parseMemSize(tt.s)
+		if gotErr := err != nil; gotErr != tt.wantErr || got != tt.want {
+			t.Errorf("parseMemSize(%q) = %#x, %v, want %#x, error %t", tt.s, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2026 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kexec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrNoCorebootTable is returned when no coreboot table can be found. It
+// wraps ErrSourceUnavailable.
+var ErrNoCorebootTable = fmt.Errorf("no coreboot table found: %w", ErrSourceUnavailable)
+
+const (
+	// cbHeaderSize is the size of struct lb_header.
+	cbHeaderSize = 24
+	// cbMemRangeSize is the size of struct lb_memory_range.
+	cbMemRangeSize = 20
+
+	// cbMaxTableSize bounds the sizes read from a coreboot header, which
+	// may be corrupt. Real tables are a few KiB.
+	cbMaxTableSize = 1 << 20
+
+	cbTagMemory  = 0x01
+	cbTagForward = 0x11
+)
+
+// cbSearchWindows are the places coreboot leaves a pointer to its table:
+// the first 4K of memory and the legacy BIOS area.
+var cbSearchWindows = []struct {
+	start, size int64
+}{
+	{0, 0x1000},
+	{0xf0000, 0x10000},
+}
+
+// findCorebootHeader looks for the LBIO signature of a coreboot table
+// header on a 16-byte boundary in the coreboot search windows of mem.
+func findCorebootHeader(mem io.ReaderAt) (int64, error) {
+	for _, w := range cbSearchWindows {
+		b := make([]byte, w.size)
+		n, _ := mem.ReadAt(b, w.start)
+		for i := 0; i+cbHeaderSize <= n; i += 0x10 {
+			if bytes.Equal(b[i:i+4], []byte("LBIO")) {
+				return w.start + int64(i), nil
+			}
+		}
+	}
+	return 0, ErrNoCorebootTable
+}
+
+// readCorebootTable reads the records of the coreboot table whose header is
+// at addr in mem.
+func readCorebootTable(mem io.ReaderAt, addr int64) ([]byte, error) {
+	hdr := make([]byte, cbHeaderSize)
+	if _, err := mem.ReadAt(hdr, addr); err != nil {
+		return nil, fmt.Errorf("reading coreboot header at %#x: %w", addr, err)
+	}
+	if !bytes.Equal(hdr[:4], []byte("LBIO")) {
+		return nil, fmt.Errorf("%w at %#x", ErrNoCorebootTable, addr)
+	}
+	headerBytes := binary.LittleEndian.Uint32(hdr[4:])
+	tableBytes := binary.LittleEndian.Uint32(hdr[12:])
+	if headerBytes < cbHeaderSize || headerBytes > cbMaxTableSize || tableBytes > cbMaxTableSize {
+		return nil, fmt.Errorf("%w: coreboot table at %#x has header size %#x and table size %#x", ErrMalformed, addr, headerBytes, tableBytes)
+	}
+	table := make([]byte, tableBytes)
+	if _, err := mem.ReadAt(table, addr+int64(headerBytes)); err != nil {
+		return nil, fmt.Errorf("reading coreboot table at %#x: %w", addr, err)
+	}
+	return table, nil
+}
+
+// memoryMapFromCorebootMem finds the coreboot table in mem, following a
+// forward record if there is one, and returns the memory map recorded in its
+// memory record.
+func memoryMapFromCorebootMem(mem io.ReaderAt) (MemoryMap, error) {
+	addr, err := findCorebootHeader(mem)
+	if err != nil {
+		return nil, err
+	}
+
+	// The table in low memory is usually just a forward record pointing
+	// to the real table in CBMEM. Follow at most a few of them, so that a
+	// corrupt table cannot send us around in circles.
+	for hops := 0; hops < 4; hops++ {
+		table, err := readCorebootTable(mem, addr)
+		if err != nil {
+			return nil, err
+		}
+		mm, forward, err := parseCorebootRecords(table)
+		if err != nil {
+			return nil, err
+		}
+		if mm != nil {
+			return mm, nil
+		}
+		if forward == 0 {
+			return nil, fmt.Errorf("%w: coreboot table at %#x has no memory record", ErrMalformed, addr)
+		}
+		addr = forward
+	}
+	return nil, fmt.Errorf("%w: too many coreboot forward records", ErrMalformed)
+}
+
+// parseCorebootRecords walks the records of a coreboot table. It returns
+// the memory map of the LB_TAG_MEMORY record if there is one, and otherwise
+// the address in an LB_TAG_FORWARD record, if any.
+func parseCorebootRecords(table []byte) (MemoryMap, int64, error) {
+	var forward int64
+	for len(table) >= 8 {
+		tag := binary.LittleEndian.Uint32(table)
+		size := binary.LittleEndian.Uint32(table[4:])
+		if size < 8 || int(size) > len(table) {
+			return nil, 0, fmt.Errorf("%w: coreboot record with tag %#x has invalid size %d", ErrMalformed, tag, size)
+		}
+		rec := table[8:size]
+		table = table[size:]
+
+		switch tag {
+		case cbTagMemory:
+			mm, err := parseCorebootMemory(rec)
+			return mm, 0, err
+		case cbTagForward:
+			if len(rec) < 8 {
+				return nil, 0, fmt.Errorf("%w: short coreboot forward record", ErrMalformed)
+			}
+			forward = int64(binary.LittleEndian.Uint64(rec))
+		}
+	}
+	return nil, forward, nil
+}
+
+// parseCorebootMemory parses the body of an LB_TAG_MEMORY record, an array
+// of struct lb_memory_range.
+//
+// coreboot's LB_MEM_* values for RAM, reserved, ACPI and NVS are the same as
+// e820's, and everything else (unusable, vendor reserved, coreboot tables)
+// is reserved memory as far as the next kernel is concerned.
+func parseCorebootMemory(rec []byte) (MemoryMap, error) {
+	mm := MemoryMap{}
+	for ; len(rec) >= cbMemRangeSize; rec = rec[cbMemRangeSize:] {
+		e := e820Entry{
+			Addr: binary.LittleEndian.Uint64(rec),
+			Size: binary.LittleEndian.Uint64(rec[8:]),
+			Type: binary.LittleEndian.Uint32(rec[16:]),
+		}
+		if err := mm.insertE820(e); err != nil {
+			return nil, err
+		}
+	}
+	mm.Merge()
+	return mm, nil
+}
+
+// MemoryMapFromCoreboot returns the memory map coreboot recorded in its
+// coreboot table, reading it through /dev/mem.
+//
+// It returns ErrNoCorebootTable if the system was not booted by coreboot.
+func MemoryMapFromCoreboot() (MemoryMap, error) {
+	f, err := os.Open("/dev/mem")
+	if err != nil {
+		return nil, sourceError("/dev/mem", err)
+	}
+	defer f.Close()
+	return memoryMapFromCorebootMem(f)
+}
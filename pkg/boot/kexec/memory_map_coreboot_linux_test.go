@@ -0,0 +1,123 @@
+// Copyright 2026 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kexec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// cbTable builds a coreboot table (header plus records) out of records.
+func cbTable(records ...[]byte) []byte {
+	body := bytes.Join(records, nil)
+	hdr := make([]byte, cbHeaderSize)
+	copy(hdr, "LBIO")
+	binary.LittleEndian.PutUint32(hdr[4:], cbHeaderSize)
+	binary.LittleEndian.PutUint32(hdr[12:], uint32(len(body)))
+	binary.LittleEndian.PutUint32(hdr[20:], uint32(len(records)))
+	return append(hdr, body...)
+}
+
+func cbRecord(tag uint32, body []byte) []byte {
+	rec := make([]byte, 8, 8+len(body))
+	binary.LittleEndian.PutUint32(rec, tag)
+	binary.LittleEndian.PutUint32(rec[4:], uint32(8+len(body)))
+	return append(rec, body...)
+}
+
+func cbMemRange(start, size uint64, typ uint32) []byte {
+	b := make([]byte, cbMemRangeSize)
+	binary.LittleEndian.PutUint64(b, start)
+	binary.LittleEndian.PutUint64(b[8:], size)
+	binary.LittleEndian.PutUint32(b[16:], typ)
+	return b
+}
+
+func TestMemoryMapFromCorebootMem(t *testing.T) {
+	memRecord := cbRecord(cbTagMemory, bytes.Join([][]byte{
+		cbMemRange(0x100000, 0x7ff00000, 1),
+		cbMemRange(0, 0x1000, 16),
+		cbMemRange(0x1000, 0x9f000, 1),
+		// Overlaps the end of the RAM above, and wins.
+		cbMemRange(0x7fe00000, 0x200000, 4),
+		cbMemRange(0xfed00000, 0x1000, 6),
+		cbMemRange(0xfee00000, 0, 2),
+	}, nil))
+	wantMap := MemoryMap{
+		TypedRange{Range: Range{Start: 0, Size: 0x1000}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 0x1000, Size: 0x9f000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x100000, Size: 0x7fd00000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x7fe00000, Size: 0x200000}, Type: RangeNVS},
+		TypedRange{Range: Range{Start: 0xfed00000, Size: 0x1000}, Type: RangeReserved},
+	}
+
+	forward := make([]byte, 8)
+	binary.LittleEndian.PutUint64(forward, 0x2000)
+
+	overflow := cbTable(cbRecord(cbTagMemory, cbMemRange(0xffffffffffff0000, 0x20000, 1)))
+
+	huge := cbTable(memRecord)
+	binary.LittleEndian.PutUint32(huge[12:], 0xffffffff)
+
+	for _, tt := range []struct {
+		name    string
+		mem     map[int64][]byte
+		want    MemoryMap
+		wantErr error
+	}{
+		{
+			name: "direct",
+			mem:  map[int64][]byte{0x500: cbTable(cbRecord(0x3, []byte("mainboard")), memRecord)},
+			want: wantMap,
+		},
+		{
+			name: "forwarded",
+			mem: map[int64][]byte{
+				0x10:   cbTable(cbRecord(cbTagForward, forward)),
+				0x2000: cbTable(memRecord),
+			},
+			want: wantMap,
+		},
+		{
+			name:    "not coreboot",
+			mem:     map[int64][]byte{0x500: []byte("not a coreboot table")},
+			wantErr: ErrNoCorebootTable,
+		},
+		{
+			name:    "huge table size",
+			mem:     map[int64][]byte{0x500: huge},
+			wantErr: ErrMalformed,
+		},
+		{
+			name:    "range beyond the address space",
+			mem:     map[int64][]byte{0x500: overflow},
+			wantErr: ErrMalformed,
+		},
+		{
+			name: "forward to nowhere",
+			mem: map[int64][]byte{
+				0x10: cbTable(cbRecord(cbTagForward, forward)),
+			},
+			wantErr: ErrNoCorebootTable,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := make([]byte, 0x3000)
+			for addr, b := range tt.mem {
+				copy(mem[addr:], b)
+			}
+			got, err := memoryMapFromCorebootMem(bytes.NewReader(mem))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("memoryMapFromCorebootMem() = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("memoryMapFromCorebootMem() =\n%v, want\n%v", got, tt.want)
+			}
+		})
+	}
+}
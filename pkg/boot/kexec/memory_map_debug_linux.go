@@ -0,0 +1,14 @@
+// Copyright 2026 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build kexecdebug
+
+package kexec
+
+// checkMemoryMapInvariants makes Insert panic as soon as it produces an
+// unsorted or overlapping map, or one with empty ranges, rather than leaving
+// the corruption to surface much later during kexec.
+//
+// It is enabled by building with -tags kexecdebug.
+const checkMemoryMapInvariants = true
@@ -0,0 +1,21 @@
+// Copyright 2026 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build kexecdebug
+
+package kexec
+
+import "testing"
+
+func TestInsertPanicsOnCorruption(t *testing.T) {
+	mm := MemoryMap{
+		TypedRange{Range: Range{Start: 0, Size: 0x1000}, Type: RangeRAM},
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Insert of an empty range did not panic")
+		}
+	}()
+	mm.Insert(TypedRange{Range: Range{Start: 0x2000, Size: 0}, Type: RangeReserved})
+}
@@ -0,0 +1,119 @@
+// Copyright 2026 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kexec
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// dmesgE820Types maps the type words the kernel's e820 printk uses to range
+// types. "persistent (type N)" and "type N" are handled by e820ToRangeType.
+var dmesgE820Types = map[string]RangeType{
+	"usable":        RangeRAM,
+	"reserved":      RangeReserved,
+	"soft reserved": RangeReserved,
+	"unusable":      RangeReserved,
+	"ACPI data":     RangeACPI,
+	"ACPI NVS":      RangeNVS,
+}
+
+// dmesgE820Type returns the range type for the type words of an e820 printk
+// line. Unknown types are treated as reserved, as in MemoryMapFromE820Bytes.
+func dmesgE820Type(s string) RangeType {
+	if typ, ok := dmesgE820Types[s]; ok {
+		return typ
+	}
+	s = strings.TrimPrefix(s, "persistent (")
+	s = strings.TrimSuffix(s, ")")
+	if n, ok := strings.CutPrefix(s, "type "); ok {
+		if v, err := strconv.ParseUint(n, 10, 32); err == nil {
+			if typ, ok := e820ToRangeType[uint32(v)]; ok {
+				return typ
+			}
+		}
+	}
+	return RangeReserved
+}
+
+// parseDmesgE820Line parses the part of a BIOS-e820 printk line after the
+// "BIOS-e820:" tag, such as
+//
+//	[mem 0x0000000000000000-0x000000000009fbff] usable
+//
+// It returns a nil range for empty ranges.
+func parseDmesgE820Line(s string) (*TypedRange, error) {
+	s, ok := strings.CutPrefix(strings.TrimSpace(s), "[mem ")
+	if !ok {
+		return nil, fmt.Errorf("missing [mem")
+	}
+	addrs, typ, ok := strings.Cut(s, "]")
+	if !ok {
+		return nil, fmt.Errorf("missing ]")
+	}
+	startS, endS, ok := strings.Cut(addrs, "-")
+	if !ok {
+		return nil, fmt.Errorf("missing - in %q", addrs)
+	}
+	start, err := strconv.ParseUint(startS, 0, 64)
+	if err != nil {
+		return nil, err
+	}
+	end, err := strconv.ParseUint(endS, 0, 64)
+	if err != nil {
+		return nil, err
+	}
+	if end < start || end > uint64(MaxAddr) || end-start >= uint64(^uint(0)) {
+		return nil, fmt.Errorf("invalid range %#x-%#x", start, end)
+	}
+	if isEmptyInclusiveRange(uintptr(start), uintptr(end)) {
+		return nil, nil
+	}
+	return &TypedRange{
+		Range: RangeFromInclusiveInterval(uintptr(start), uintptr(end)),
+		Type:  dmesgE820Type(strings.TrimSpace(typ)),
+	}, nil
+}
+
+// MemoryMapFromDmesgE820 reads the firmware memory map from the kernel's
+// boot log, e.g. the output of dmesg or a captured serial console, using
+// lines such as
+//
+//	[    0.000000] BIOS-e820: [mem 0x0000000000000000-0x000000000009fbff] usable
+//	[    0.000000] BIOS-e820: [mem 0x000000000009fc00-0x000000000009ffff] reserved
+//
+// All other lines are ignored. It returns an error wrapping
+// ErrSourceUnavailable if r contains no BIOS-e820 lines.
+func MemoryMapFromDmesgE820(r io.Reader) (MemoryMap, error) {
+	var mm MemoryMap
+	var found bool
+	b := bufio.NewScanner(r)
+	for b.Scan() {
+		_, entry, ok := strings.Cut(b.Text(), "BIOS-e820:")
+		if !ok {
+			continue
+		}
+		found = true
+		tr, err := parseDmesgE820Line(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%w: BIOS-e820 line %q: %w", ErrMalformed, b.Text(), err)
+		}
+		if tr != nil {
+			mm.Insert(*tr)
+		}
+	}
+	if err := b.Err(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: no BIOS-e820 lines in boot log", ErrSourceUnavailable)
+	}
+	mm.sort()
+	mm.Merge()
+	return mm, nil
+}
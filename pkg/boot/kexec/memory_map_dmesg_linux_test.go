@@ -0,0 +1,78 @@
+// Copyright 2026 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kexec
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMemoryMapFromDmesgE820(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		log     string
+		want    MemoryMap
+		wantErr error
+	}{
+		{
+			name: "boot log",
+			log: `[    0.000000] Linux version 6.1.0 (gcc 12.2.0)
+[    0.000000] BIOS-provided physical RAM map:
+[    0.000000] BIOS-e820: [mem 0x0000000000000000-0x000000000009fbff] usable
+[    0.000000] BIOS-e820: [mem 0x000000000009fc00-0x000000000009ffff] reserved
+[    0.000000] BIOS-e820: [mem 0x0000000000100000-0x000000007fffffff] usable
+[    0.000000] BIOS-e820: [mem 0x0000000080000000-0x000000008000ffff] ACPI data
+[    0.000000] BIOS-e820: [mem 0x0000000080010000-0x000000008001ffff] ACPI NVS
+[    0.000000] BIOS-e820: [mem 0x00000000c0000000-0x00000000dfffffff] persistent (type 7)
+[    0.000000] BIOS-e820: [mem 0x00000000e0000000-0x00000000e0000fff] type 20
+[    0.000000] NX (Execute Disable) protection: active
+[    0.000000] e820: update [mem 0x00000000-0x00000fff] usable ==> reserved
+`,
+			want: MemoryMap{
+				TypedRange{Range: Range{Start: 0, Size: 0x9fc00}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0x9fc00, Size: 0x400}, Type: RangeReserved},
+				TypedRange{Range: Range{Start: 0x100000, Size: 0x7ff00000}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0x80000000, Size: 0x10000}, Type: RangeACPI},
+				TypedRange{Range: Range{Start: 0x80010000, Size: 0x10000}, Type: RangeNVS},
+				TypedRange{Range: Range{Start: 0xc0000000, Size: 0x20000000}, Type: RangePersistent},
+				TypedRange{Range: Range{Start: 0xe0000000, Size: 0x1000}, Type: RangeReserved},
+			},
+		},
+		{
+			name: "without timestamps",
+			log:  "BIOS-e820: [mem 0x0000000000000000-0x000000000009fbff] usable\n",
+			want: MemoryMap{
+				TypedRange{Range: Range{Start: 0, Size: 0x9fc00}, Type: RangeRAM},
+			},
+		},
+		{
+			name:    "no e820 lines",
+			log:     "[    0.000000] Linux version 6.1.0\n",
+			wantErr: ErrSourceUnavailable,
+		},
+		{
+			name:    "malformed",
+			log:     "[    0.000000] BIOS-e820: [mem 0x0000000000000000-foo] usable\n",
+			wantErr: ErrMalformed,
+		},
+		{
+			name:    "reversed",
+			log:     "[    0.000000] BIOS-e820: [mem 0x0000000000001000-0x0000000000000fff] usable\n",
+			wantErr: ErrMalformed,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mm, err := MemoryMapFromDmesgE820(strings.NewReader(tt.log))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("MemoryMapFromDmesgE820() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(mm, tt.want) {
+				t.Errorf("MemoryMapFromDmesgE820() =\n%v, want\n%v", mm, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2026 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kexec
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// e820Entry is a struct boot_e820_entry as used by the Linux boot protocol.
+type e820Entry struct {
+	Addr uint64
+	Size uint64
+	Type uint32
+}
+
+// e820EntrySize is the size of a packed e820Entry in bytes.
+const e820EntrySize = 20
+
+var e820ToRangeType = map[uint32]RangeType{
+	1:  RangeRAM,
+	2:  RangeReserved,
+	3:  RangeACPI,
+	4:  RangeNVS,
+	7:  RangePersistent,
+	12: RangePersistentLegacy,
+}
+
+// MemoryMapFromE820Bytes parses a raw e820 memory map, i.e. an array of
+// little-endian struct boot_e820_entry, as handed off by some bootloaders.
+//
+// Unknown e820 types are treated as reserved.
+func MemoryMapFromE820Bytes(b []byte) (MemoryMap, error) {
+	if len(b)%e820EntrySize != 0 {
+		return nil, fmt.Errorf("%w: e820 map of %d bytes is not a multiple of the entry size %d", ErrMalformed, len(b), e820EntrySize)
+	}
+
+	var mm MemoryMap
+	for i := 0; i < len(b); i += e820EntrySize {
+		e := e820Entry{
+			Addr: binary.LittleEndian.Uint64(b[i:]),
+			Size: binary.LittleEndian.Uint64(b[i+8:]),
+			Type: binary.LittleEndian.Uint32(b[i+16:]),
+		}
+		if err := mm.insertE820(e); err != nil {
+			return nil, err
+		}
+	}
+	mm.Merge()
+	return mm, nil
+}
+
+// insertE820 inserts e into mm with Insert, so that overlapping entries still
+// leave a valid map: later entries win, as they would in the kernel's
+// sanitized map. Empty entries are skipped, and entries that do not fit into
+// the address space are ErrMalformed.
+func (mm *MemoryMap) insertE820(e e820Entry) error {
+	if e.Size == 0 {
+		return nil
+	}
+	last := e.Addr + e.Size - 1
+	if last < e.Addr || last > uint64(MaxAddr) || e.Size > uint64(^uint(0)) {
+		return fmt.Errorf("%w: e820 entry at %#x of %#x bytes exceeds the address space", ErrMalformed, e.Addr, e.Size)
+	}
+	typ, ok := e820ToRangeType[e.Type]
+	if !ok {
+		typ = RangeReserved
+	}
+	mm.Insert(TypedRange{Range: Range{Start: uintptr(e.Addr), Size: uint(e.Size)}, Type: typ})
+	return nil
+}
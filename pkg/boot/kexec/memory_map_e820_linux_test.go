@@ -0,0 +1,60 @@
+// Copyright 2026 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kexec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMemoryMapFromE820Bytes(t *testing.T) {
+	entries := []e820Entry{
+		{Addr: 0x100000, Size: 0x7ff00000, Type: 1},
+		{Addr: 0, Size: 0x9fc00, Type: 1},
+		{Addr: 0x9fc00, Size: 0x400, Type: 2},
+		{Addr: 0x80000000, Size: 0x10000, Type: 3},
+		{Addr: 0x80010000, Size: 0x10000, Type: 4},
+		{Addr: 0x80020000, Size: 0, Type: 1},
+		{Addr: 0x90000000, Size: 0x1000, Type: 5},
+		// Overlaps the RAM above; later entries win.
+		{Addr: 0x7ff00000, Size: 0x100000, Type: 2},
+	}
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	mm, err := MemoryMapFromE820Bytes(buf.Bytes())
+	if err != nil {
+		t.Fatalf("MemoryMapFromE820Bytes() error: %v", err)
+	}
+	want := MemoryMap{
+		TypedRange{Range: Range{Start: 0, Size: 0x9fc00}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x9fc00, Size: 0x400}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 0x100000, Size: 0x7fe00000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x7ff00000, Size: 0x100000}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 0x80000000, Size: 0x10000}, Type: RangeACPI},
+		TypedRange{Range: Range{Start: 0x80010000, Size: 0x10000}, Type: RangeNVS},
+		TypedRange{Range: Range{Start: 0x90000000, Size: 0x1000}, Type: RangeReserved},
+	}
+	if !reflect.DeepEqual(mm, want) {
+		t.Errorf("MemoryMapFromE820Bytes() =\n%v, want\n%v", mm, want)
+	}
+
+	if _, err := MemoryMapFromE820Bytes(buf.Bytes()[:e820EntrySize+1]); err == nil {
+		t.Errorf("MemoryMapFromE820Bytes(short blob) = nil, want error")
+	}
+
+	buf.Reset()
+	if err := binary.Write(&buf, binary.LittleEndian, e820Entry{Addr: 0xffffffffffff0000, Size: 0x20000, Type: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MemoryMapFromE820Bytes(buf.Bytes()); !errors.Is(err, ErrMalformed) {
+		t.Errorf("MemoryMapFromE820Bytes(overflowing entry) = %v, want %v", err, ErrMalformed)
+	}
+}
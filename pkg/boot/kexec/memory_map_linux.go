@@ -6,16 +6,24 @@ package kexec
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"text/tabwriter"
 
+	"github.com/dustin/go-humanize"
+	"github.com/u-root/u-root/pkg/align"
 	"github.com/u-root/u-root/pkg/dt"
 )
 
@@ -30,6 +38,13 @@ const (
 	RangeACPI     RangeType = "ACPI Tables"
 	RangeNVS      RangeType = "ACPI Non-volatile Storage"
 	RangeReserved RangeType = "Reserved"
+
+	// RangePersistent is NVDIMM persistent memory described by ACPI NFIT
+	// (e820 type 7).
+	RangePersistent RangeType = "Persistent Memory"
+	// RangePersistentLegacy is persistent memory described by the
+	// pre-standard e820 type 12, or created with memmap=nn!ss.
+	RangePersistentLegacy RangeType = "Persistent Memory (legacy)"
 )
 
 // String implements fmt.Stringer.
@@ -38,12 +53,14 @@ func (r RangeType) String() string {
 }
 
 var sysfsToRangeType = map[string]RangeType{
-	"System RAM":                RangeRAM,
-	"Default":                   RangeDefault,
-	"ACPI Tables":               RangeACPI,
-	"ACPI Non-volatile Storage": RangeNVS,
-	"Reserved":                  RangeReserved,
-	"reserved":                  RangeReserved,
+	"System RAM":                 RangeRAM,
+	"Default":                    RangeDefault,
+	"ACPI Tables":                RangeACPI,
+	"ACPI Non-volatile Storage":  RangeNVS,
+	"Reserved":                   RangeReserved,
+	"reserved":                   RangeReserved,
+	"Persistent Memory":          RangePersistent,
+	"Persistent Memory (legacy)": RangePersistentLegacy,
 }
 
 // TypedRange represents range of physical memory.
@@ -56,21 +73,59 @@ func (tr TypedRange) String() string {
 	return fmt.Sprintf("{addr: %s, type: %s}", tr.Range, tr.Type)
 }
 
+// Errors returned by the MemoryMapFrom* functions, to be checked with
+// errors.Is. The underlying error stays wrapped, so that e.g. a permission
+// problem can still be told apart with fs.ErrPermission.
+var (
+	// ErrSourceUnavailable means that the source of a memory map does not
+	// exist on this system, e.g. /sys/firmware/memmap on non-x86 machines.
+	ErrSourceUnavailable = errors.New("memory map source not available")
+
+	// ErrMalformed means that the source of a memory map exists but its
+	// contents cannot be parsed.
+	ErrMalformed = errors.New("malformed memory map")
+)
+
+// sourceError annotates err, returned when opening the memory map source src,
+// with ErrSourceUnavailable if src does not exist.
+func sourceError(src string, err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%s: %w: %w", src, ErrSourceUnavailable, err)
+	}
+	return fmt.Errorf("%s: %w", src, err)
+}
+
 // MemoryMap defines the layout of physical memory.
 //
 // MemoryMap defines which ranges in memory are usable RAM and which are
 // reserved for various reasons.
 type MemoryMap []TypedRange
 
+// String returns mm as a table with one line per range, sorted by start
+// address: the start and (exclusive) end address, the size in powers of
+// 1024, and the type.
 func (mm MemoryMap) String() string {
+	sorted := mm.Clone()
+	sorted.sort()
+
 	var s strings.Builder
-	for _, tr := range mm {
-		s.WriteString(tr.String())
-		s.WriteString("\n")
+	tw := tabwriter.NewWriter(&s, 0, 0, 2, ' ', 0)
+	for _, tr := range sorted {
+		fmt.Fprintf(tw, "%#016x\t%#016x\t%s\t%s\n", tr.Start, tr.End(), humanize.IBytes(uint64(tr.Size)), tr.Type)
 	}
+	tw.Flush()
 	return s.String()
 }
 
+// Clone returns a copy of mm that does not share its backing array, so that
+// e.g. Insert on the copy leaves mm unaffected.
+func (mm MemoryMap) Clone() MemoryMap {
+	if mm == nil {
+		return nil
+	}
+	return append(make(MemoryMap, 0, len(mm)), mm...)
+}
+
 // FilterByType only returns ranges of the given typ.
 func (mm MemoryMap) FilterByType(typ RangeType) Ranges {
 	var rs Ranges
@@ -82,19 +137,250 @@ func (mm MemoryMap) FilterByType(typ RangeType) Ranges {
 	return rs
 }
 
+// RemoveType returns a copy of mm without the ranges of the given typ.
+func (mm MemoryMap) RemoveType(typ RangeType) MemoryMap {
+	var m MemoryMap
+	for _, tr := range mm {
+		if tr.Type != typ {
+			m = append(m, tr)
+		}
+	}
+	return m
+}
+
+// Intersections returns the parts of the ranges in mm that overlap r, with
+// their types, in the order of mm. It does not modify mm.
+func (mm MemoryMap) Intersections(r Range) []TypedRange {
+	if r.Size == 0 {
+		return nil
+	}
+	var trs []TypedRange
+	for _, tr := range mm {
+		if i := tr.Intersect(r); i != nil {
+			trs = append(trs, TypedRange{Range: *i, Type: tr.Type})
+		}
+	}
+	return trs
+}
+
+// ForEachIn calls fn with the part of each range of mm that overlaps window,
+// in order. It stops at and returns the first error fn returns.
+//
+// mm must be sorted and free of overlaps, as maps built by this package are,
+// so that the first range to visit can be found by binary search.
+func (mm MemoryMap) ForEachIn(window Range, fn func(TypedRange) error) error {
+	if window.Size == 0 {
+		return nil
+	}
+	i := sort.Search(len(mm), func(i int) bool {
+		return mm[i].End() > window.Start
+	})
+	for ; i < len(mm) && mm[i].Start < window.End(); i++ {
+		r := mm[i].Intersect(window)
+		if r == nil {
+			continue
+		}
+		if err := fn(TypedRange{Range: *r, Type: mm[i].Type}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DiffMemoryMaps returns the ranges that changed between two reads of the
+// memory map: added holds the parts of cur that old did not have with the
+// same type, removed the parts of old that cur no longer has with the same
+// type. A range whose type changed thus appears in both.
+//
+// Adjacent changes of the same type are merged, so that e.g. a hotplugged
+// DIMM shows up as a single added RAM range. Both maps must be sorted and
+// free of overlaps.
+func DiffMemoryMaps(old, cur MemoryMap) (added, removed MemoryMap) {
+	return cur.typedMinus(old), old.typedMinus(cur)
+}
+
+// typedMinus returns the parts of the ranges of mm that other does not have
+// with the same type, merged where adjacent.
+func (mm MemoryMap) typedMinus(other MemoryMap) MemoryMap {
+	var diff MemoryMap
+	for _, tr := range mm {
+		rest := Ranges{tr.Range}
+		for _, o := range other.Intersections(tr.Range) {
+			if o.Type == tr.Type {
+				rest = rest.Minus(o.Range)
+			}
+		}
+		for _, r := range rest {
+			diff = append(diff, TypedRange{Range: r, Type: tr.Type})
+		}
+	}
+	diff.Merge()
+	return diff
+}
+
+// SplitAt partitions mm into the ranges below addr and those at or above it.
+// A range that straddles addr is cut in two, both halves keeping its type.
+// mm is not modified.
+func (mm MemoryMap) SplitAt(addr uintptr) (below, above MemoryMap) {
+	for _, tr := range mm {
+		switch {
+		case tr.End() <= addr:
+			below = append(below, tr)
+		case tr.Start >= addr:
+			above = append(above, tr)
+		default:
+			below = append(below, TypedRange{Range: RangeFromInterval(tr.Start, addr), Type: tr.Type})
+			above = append(above, TypedRange{Range: RangeFromInterval(addr, tr.End()), Type: tr.Type})
+		}
+	}
+	return below, above
+}
+
+// DefaultUsableTypes returns the range types treated as usable RAM by the
+// MemoryMap methods that take a list of types, e.g. UsableRAM, IsRAM and
+// FindSpaceTopDown, when none is given.
+//
+// Some firmware reports large Default regions that are in fact usable RAM,
+// so they count by default. On machines where they are not, pass RangeRAM
+// alone.
+func DefaultUsableTypes() []RangeType {
+	return []RangeType{RangeRAM, RangeDefault}
+}
+
+// isUsable reports whether typ is one of types, or of DefaultUsableTypes if
+// types is empty.
+func isUsable(typ RangeType, types []RangeType) bool {
+	if len(types) == 0 {
+		types = DefaultUsableTypes()
+	}
+	return slices.Contains(types, typ)
+}
+
+// UsableRAM returns the ranges of mm that are of one of types, or of
+// DefaultUsableTypes if none are given, e.g. to FindSpace in. Adjacent usable
+// ranges are merged, even if their types differ.
+func (mm MemoryMap) UsableRAM(types ...RangeType) Ranges {
+	var rs Ranges
+	for _, tr := range mm {
+		if !isUsable(tr.Type, types) {
+			continue
+		}
+		if n := len(rs); n > 0 && rs[n-1].End() == tr.Start {
+			rs[n-1].Size += tr.Size
+			continue
+		}
+		rs = append(rs, tr.Range)
+	}
+	return rs
+}
+
+// UsableRAMBelow returns the number of bytes of usable memory below addr,
+// counting ranges of types, or of DefaultUsableTypes if none are given.
+// Ranges straddling addr count only up to it.
+func (mm MemoryMap) UsableRAMBelow(addr uintptr, types ...RangeType) uint64 {
+	var total uint64
+	below := RangeFromInterval(0, addr)
+	for _, tr := range mm {
+		if !isUsable(tr.Type, types) {
+			continue
+		}
+		if r := tr.Intersect(below); r != nil {
+			total += uint64(r.Size)
+		}
+	}
+	return total
+}
+
+// IsRAM reports whether every byte of r is covered by usable memory, i.e.
+// ranges of types, or of DefaultUsableTypes if none are given, so that a
+// segment may be placed at r. Unlike an overlap check, any gap or range of
+// another type inside r makes it false.
+//
+// mm must be sorted and free of overlaps. An empty r is trivially RAM.
+func (mm MemoryMap) IsRAM(r Range, types ...RangeType) bool {
+	errNotRAM := errors.New("not RAM")
+	next := r.Start
+	err := mm.ForEachIn(r, func(tr TypedRange) error {
+		if tr.Start != next || !isUsable(tr.Type, types) {
+			return errNotRAM
+		}
+		next = tr.End()
+		return nil
+	})
+	return err == nil && next == r.End()
+}
+
+// Gaps returns the holes in the address space between the lowest start and
+// the highest end of the sorted mm that no range covers. Maps with fewer than
+// two ranges have no gaps.
+func (mm MemoryMap) Gaps() Ranges {
+	if len(mm) == 0 {
+		return nil
+	}
+	var gaps Ranges
+	end := mm[0].End()
+	for _, tr := range mm[1:] {
+		if tr.Start > end {
+			gaps = append(gaps, RangeFromInterval(end, tr.Start))
+		}
+		end = max(end, tr.End())
+	}
+	return gaps
+}
+
+// CoverGaps returns a copy of the sorted mm in which every address from 0
+// to the highest end of mm is described: the gaps, including one below the
+// lowest range, are filled with ranges of type typ. The ranges of mm are left
+// as they are.
+func (mm MemoryMap) CoverGaps(typ RangeType) MemoryMap {
+	covered := mm.Clone()
+	gaps := mm.Gaps()
+	if len(mm) > 0 && mm[0].Start > 0 {
+		gaps = append(gaps, RangeFromInterval(0, mm[0].Start))
+	}
+	for _, r := range gaps {
+		covered.Insert(TypedRange{Range: r, Type: typ})
+	}
+	return covered
+}
+
 // RAM is an alias for FilterByType(RangeRAM) and returns unreserved physical
 // memory in the memory map.
 func (mm MemoryMap) RAM() Ranges {
 	return mm.FilterByType(RangeRAM)
 }
 
+// AvailableRAMWithGuard returns the ranges in mm of types, or of
+// DefaultUsableTypes if none are given, each shrunk by guard bytes at its
+// start and at its end, so that space found in them never directly borders a
+// reserved region or the end of RAM.
+//
+// Ranges no larger than 2*guard are dropped.
+func (mm MemoryMap) AvailableRAMWithGuard(guard uint, types ...RangeType) Ranges {
+	var rs Ranges
+	for _, r := range mm.UsableRAM(types...) {
+		if r.Size <= 2*guard {
+			continue
+		}
+		rs = append(rs, Range{Start: r.Start + uintptr(guard), Size: r.Size - 2*guard})
+	}
+	return rs
+}
+
 func (mm MemoryMap) sort() {
 	sort.Slice(mm, func(i, j int) bool {
 		return mm[i].Start < mm[j].Start
 	})
 }
 
-func (mm *MemoryMap) mergeAdjacent() {
+// Merge coalesces ranges of the same type that touch or overlap, e.g. the
+// many contiguous "System RAM" entries of /proc/iomem, leaving gaps and the
+// order of ranges alone. mm must be sorted by start address, as the maps
+// returned by this package are.
+//
+// A merged map has the fewest entries describing the same memory, which
+// matters for consumers with fixed-size tables such as UEFI payloads.
+func (mm *MemoryMap) Merge() {
 	if len(*mm) == 0 {
 		return
 	}
@@ -123,23 +409,184 @@ func (mm *MemoryMap) mergeAdjacent() {
 // Insert a new TypedRange into the memory map, removing chunks of other ranges
 // as necessary.
 //
+// If mm is sorted and free of overlaps, as all maps built by this package
+// are, only the ranges overlapping r are touched and mm is updated in place;
+// Clone it first to keep the original. Other maps, e.g. ones assembled by
+// hand, are rebuilt as a whole.
+//
 // Assumes that TypedRange is a valid range -- no checking.
 func (mm *MemoryMap) Insert(r TypedRange) {
-	var newMap MemoryMap
+	m := *mm
+	if !m.sortedWithoutOverlaps() {
+		mm.insertSlow(r)
+		return
+	}
+
+	// m[lo:hi] are the ranges that have points in r. Since m is sorted
+	// and free of overlaps, both starts and ends are increasing.
+	lo := sort.Search(len(m), func(i int) bool {
+		return m[i].End() > r.Start
+	})
+	hi := lo + sort.Search(len(m)-lo, func(i int) bool {
+		return m[lo+i].Start >= r.End()
+	})
 
-	// Remove points in r from all existing physical ranges.
+	// Of m[lo:hi], only the part of the first range below r and the part
+	// of the last range above r remain.
+	var buf [3]TypedRange
+	repl := buf[:0]
+	if lo < hi && m[lo].Start < r.Start {
+		repl = append(repl, TypedRange{Range: RangeFromInterval(m[lo].Start, r.Start), Type: m[lo].Type})
+	}
+	repl = append(repl, r)
+	if lo < hi && m[hi-1].End() > r.End() {
+		repl = append(repl, TypedRange{Range: RangeFromInterval(r.End(), m[hi-1].End()), Type: m[hi-1].Type})
+	}
+	*mm = slices.Replace(m, lo, hi, repl...)
+
+	if checkMemoryMapInvariants {
+		if err := mm.checkInvariants(); err != nil {
+			panic(fmt.Sprintf("memory map corrupt after inserting %v: %v\n%v", r, err, *mm))
+		}
+	}
+}
+
+// sortedWithoutOverlaps returns true if every range of mm starts at or after
+// the end of the one before it.
+func (mm MemoryMap) sortedWithoutOverlaps() bool {
+	for i := 1; i < len(mm); i++ {
+		if mm[i].Start < mm[i-1].End() {
+			return false
+		}
+	}
+	return true
+}
+
+// insertSlow inserts r into mm, which may be unsorted or have overlapping
+// ranges: r is removed from every range, and the result sorted.
+func (mm *MemoryMap) insertSlow(r TypedRange) {
+	var newMap MemoryMap
 	for _, q := range *mm {
-		split := q.Range.Minus(r.Range)
-		for _, r2 := range split {
+		for _, r2 := range q.Range.Minus(r.Range) {
 			newMap = append(newMap, TypedRange{Range: r2, Type: q.Type})
 		}
 	}
-
 	newMap = append(newMap, r)
 	newMap.sort()
 	*mm = newMap
 }
 
+// checkInvariants returns an error if mm is not sorted, has overlapping
+// ranges, or has empty ranges.
+func (mm MemoryMap) checkInvariants() error {
+	for i, tr := range mm {
+		if tr.Size == 0 {
+			return fmt.Errorf("range %v is empty", tr)
+		}
+		if tr.End() < tr.Start {
+			return fmt.Errorf("range %v wraps around the address space", tr)
+		}
+		if i == 0 {
+			continue
+		}
+		prev := mm[i-1]
+		if tr.Start < prev.Start {
+			return fmt.Errorf("range %v is not sorted after %v", tr, prev)
+		}
+		if tr.Overlaps(prev.Range) {
+			return fmt.Errorf("range %v overlaps %v", tr, prev)
+		}
+	}
+	return nil
+}
+
+// Validate returns an error naming the offending ranges if, once sorted by
+// start address, any ranges of mm overlap, any range is empty, or any range
+// extends past the end of the address space.
+//
+// Insert and the maps returned by this package assume none of these; Validate
+// is meant for maps assembled from untrusted sources, e.g. a buggy FDT.
+func (mm MemoryMap) Validate() error {
+	sorted := mm.Clone()
+	sorted.sort()
+	if err := sorted.checkInvariants(); err != nil {
+		return fmt.Errorf("invalid memory map: %w", err)
+	}
+	return nil
+}
+
+// FindCrashKernelRegion finds size bytes of RAM starting at an address aligned
+// to align that end at or below the address below, suitable to be reserved
+// for a crash kernel like crashkernel=size@... does.
+//
+// RAM means ranges of types, or of DefaultUsableTypes if none are given. If
+// below is 0, the region may be anywhere in RAM. The caller is responsible
+// for inserting the returned range as RangeReserved.
+func (mm MemoryMap) FindCrashKernelRegion(size, align uint, below uintptr, types ...RangeType) (Range, error) {
+	limit := RangeFromInterval(0, MaxAddr)
+	if below != 0 {
+		limit = RangeFromInterval(0, below)
+	}
+	opts := []FindOptioner{WithinRange(limit)}
+	if align != 0 {
+		opts = append(opts, WithStartAlignment(align))
+	}
+	r, err := mm.UsableRAM(types...).FindSpace(size, opts...)
+	if err != nil {
+		return Range{}, fmt.Errorf("no crash kernel region of %#x bytes aligned to %#x below %#x: %w", size, align, below, err)
+	}
+	return r, nil
+}
+
+// FindSpaceTopDown returns the highest address, aligned to alignSize, at
+// which size bytes fit into ranges of types, or of DefaultUsableTypes if none
+// are given.
+//
+// It is the counterpart of FindSpace for payloads that should be placed high
+// in memory, e.g. to keep low memory clear for legacy devices. An alignSize
+// of 0 means no alignment.
+func (mm MemoryMap) FindSpaceTopDown(size, alignSize uint, types ...RangeType) (uintptr, error) {
+	ram := mm.UsableRAM(types...)
+	for i := len(ram) - 1; i >= 0; i-- {
+		r := ram[i]
+		if r.Size < size {
+			continue
+		}
+		start := r.End() - uintptr(size)
+		if alignSize != 0 {
+			start = align.Down(start, uintptr(alignSize))
+		}
+		if start >= r.Start {
+			return start, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %#x bytes aligned to %#x", ErrNotEnoughSpace, size, alignSize)
+}
+
+// ReserveLowMemory marks all ranges of types, or of DefaultUsableTypes if none
+// are given, below limit as RangeReserved, so that no segment is placed there.
+//
+// On x86 the first 1MiB holds legacy BIOS and video reservations that
+// firmware does not always report; callers there typically pass 1 << 20.
+// Ranges of other types are left alone, and a limit of 0 changes nothing.
+func (mm *MemoryMap) ReserveLowMemory(limit uintptr, types ...RangeType) {
+	if limit == 0 {
+		return
+	}
+	for _, r := range mm.UsableRAM(types...) {
+		if r.Start >= limit {
+			break
+		}
+		mm.Insert(TypedRange{Range: RangeFromInterval(r.Start, min(r.End(), limit)), Type: RangeReserved})
+	}
+}
+
+// InsertType inserts a range of size bytes at start with the given typ into
+// the memory map, like Insert.
+func (mm *MemoryMap) InsertType(start uintptr, size uint, typ RangeType) {
+	mm.Insert(TypedRange{Range: Range{Start: start, Size: size}, Type: typ})
+}
+
 // MemoryMapFromFDT reads firmware provided memory map from an FDT.
 func MemoryMapFromFDT(fdt *dt.FDT) (MemoryMap, error) {
 	var mm MemoryMap
@@ -156,7 +603,7 @@ func MemoryMapFromFDT(fdt *dt.FDT) (MemoryMap, error) {
 		if found {
 			r, err := p.AsRegion()
 			if err != nil {
-				return err
+				return fmt.Errorf("%w: reg of memory node %q: %w", ErrMalformed, n.Name, err)
 			}
 			mm = append(mm, TypedRange{
 				Range: Range{Start: uintptr(r.Start), Size: uint(r.Size)},
@@ -170,18 +617,20 @@ func MemoryMapFromFDT(fdt *dt.FDT) (MemoryMap, error) {
 		return nil, err
 	}
 
+	// Insert requires a sorted map without overlaps. Merging also keeps
+	// overlapping or redundant memory nodes from counting RAM twice.
+	mm.sort()
+	mm.Merge()
+
 	reserveMemory := func(n *dt.Node) error {
 		p, found := n.LookProperty("reg")
 		if found {
 			r, err := p.AsRegion()
 			if err != nil {
-				return err
+				return fmt.Errorf("%w: reg of reserved-memory node %q: %w", ErrMalformed, n.Name, err)
 			}
 
-			mm.Insert(TypedRange{
-				Range: Range{Start: uintptr(r.Start), Size: uint(r.Size)},
-				Type:  RangeReserved,
-			})
+			mm.InsertType(uintptr(r.Start), uint(r.Size), RangeReserved)
 		}
 		return nil
 	}
@@ -194,17 +643,35 @@ func MemoryMapFromFDT(fdt *dt.FDT) (MemoryMap, error) {
 	}
 
 	for _, r := range fdt.ReserveEntries {
-		mm.Insert(TypedRange{
-			Range: Range{Start: uintptr(r.Address), Size: uint(r.Size)},
-			Type:  RangeReserved,
-		})
+		mm.InsertType(uintptr(r.Address), uint(r.Size), RangeReserved)
 	}
 
 	mm.sort()
-	mm.mergeAdjacent()
+	mm.Merge()
 	return mm, nil
 }
 
+var procDeviceTree = "/proc/device-tree"
+
+// MemoryMapFromProcDeviceTree reads the firmware-provided memory map from the
+// live device tree at /proc/device-tree, for systems, e.g. on ARM or PowerPC,
+// whose original dtb is not at hand.
+//
+// Memory and /reserved-memory nodes are handled as in MemoryMapFromFDT. The
+// file system view has no memory reservation block, so /memreserve/ entries
+// are not seen.
+func MemoryMapFromProcDeviceTree() (MemoryMap, error) {
+	return memoryMapFromDeviceTreeFS(os.DirFS(procDeviceTree))
+}
+
+func memoryMapFromDeviceTreeFS(fsys fs.FS) (MemoryMap, error) {
+	fdt, err := dt.ReadFS(fsys)
+	if err != nil {
+		return nil, sourceError(procDeviceTree, err)
+	}
+	return MemoryMapFromFDT(fdt)
+}
+
 var memoryMapRoot = "/sys/firmware/memmap/"
 
 // MemoryMapFromSysfsMemmap reads a firmware-provided memory map from /sys/firmware/memmap.
@@ -239,7 +706,7 @@ func memoryMapFromSysfsMemmap(memoryMapDir string) (MemoryMap, error) {
 
 		base := path.Base(name)
 		if base != start && base != end && base != typ {
-			return fmt.Errorf("unexpected file %q", name)
+			return fmt.Errorf("%w: unexpected file %q", ErrMalformed, name)
 		}
 		dir := path.Dir(name)
 
@@ -264,7 +731,7 @@ func memoryMapFromSysfsMemmap(memoryMapDir string) (MemoryMap, error) {
 
 		v, err := strconv.ParseUint(data, 0, strconv.IntSize)
 		if err != nil {
-			return err
+			return fmt.Errorf("%w: %s: %w", ErrMalformed, name, err)
 		}
 		switch base {
 		case start:
@@ -276,12 +743,18 @@ func memoryMapFromSysfsMemmap(memoryMapDir string) (MemoryMap, error) {
 		return nil
 	}
 
+	if _, err := os.Stat(memoryMapDir); err != nil {
+		return nil, sourceError(memoryMapDir, err)
+	}
 	if err := filepath.Walk(memoryMapDir, walker); err != nil {
 		return nil, err
 	}
 
 	var mm MemoryMap
 	for _, r := range ranges {
+		if isEmptyInclusiveRange(r.start, r.end) {
+			continue
+		}
 		// Range's end address is exclusive, while Linux's sysfs prints
 		// the end address inclusive.
 		//
@@ -298,7 +771,7 @@ func memoryMapFromSysfsMemmap(memoryMapDir string) (MemoryMap, error) {
 		})
 	}
 	mm.sort()
-	mm.mergeAdjacent()
+	mm.Merge()
 	return mm, nil
 }
 
@@ -324,12 +797,18 @@ type UEFIPayloadMemoryMapEntry struct {
 // UEFIPayloadMemoryMap is a memory map used with LinuxBoot's UEFI payload.
 type UEFIPayloadMemoryMap []UEFIPayloadMemoryMapEntry
 
+// The LinuxBoot UEFI payload has no persistent memory type, and a value it does
+// not know would be misread, so persistent memory is passed on as reserved:
+// the payload must not allocate from it either way.
 var rangeTypeToUEFIPayloadMemType = map[RangeType]UEFIPayloadMemType{
 	RangeRAM:      UEFIPayloadTypeRAM,
 	RangeDefault:  UEFIPayloadTypeDefault,
 	RangeACPI:     UEFIPayloadTypeACPI,
 	RangeNVS:      UEFIPayloadTypeNVS,
 	RangeReserved: UEFIPayloadTypeReserved,
+
+	RangePersistent:       UEFIPayloadTypeReserved,
+	RangePersistentLegacy: UEFIPayloadTypeReserved,
 }
 
 func convertToUEFIPayloadMemType(rt RangeType) UEFIPayloadMemType {
@@ -347,16 +826,89 @@ func (mm MemoryMap) ToUEFIPayloadMemoryMap() UEFIPayloadMemoryMap {
 	for _, entry := range mm {
 		p = append(p, UEFIPayloadMemoryMapEntry{
 			Start: uint64(entry.Start),
-			End:   uint64(entry.Start) + uint64(entry.Size) - 1,
+			End:   uint64(entry.Last()),
 			Type:  convertToUEFIPayloadMemType(entry.Type),
 		})
 	}
 	return p
 }
 
+// MultibootMmapType are the memory types used in multiboot memory maps.
+type MultibootMmapType uint32
+
+// Memory types in a multiboot mmap_entry.
+const (
+	MultibootMmapTypeAvailable       MultibootMmapType = 1
+	MultibootMmapTypeReserved        MultibootMmapType = 2
+	MultibootMmapTypeACPIReclaimable MultibootMmapType = 3
+	MultibootMmapTypeNVS             MultibootMmapType = 4
+	MultibootMmapTypeBadRAM          MultibootMmapType = 5
+)
+
+// MultibootMmapEntry is a memory map entry in the format of the multiboot
+// info mmap_entry.
+//
+// https://www.gnu.org/software/grub/manual/multiboot/multiboot.html#Boot-information-format
+type MultibootMmapEntry struct {
+	// Size is the size of the rest of the entry in bytes.
+	Size     uint32
+	BaseAddr uint64
+	Length   uint64
+	Type     MultibootMmapType
+}
+
+// MultibootMmap is a memory map used with multiboot kernels.
+type MultibootMmap []MultibootMmapEntry
+
+var rangeTypeToMultibootMmapType = map[RangeType]MultibootMmapType{
+	RangeRAM:      MultibootMmapTypeAvailable,
+	RangeDefault:  MultibootMmapTypeReserved,
+	RangeACPI:     MultibootMmapTypeACPIReclaimable,
+	RangeNVS:      MultibootMmapTypeNVS,
+	RangeReserved: MultibootMmapTypeReserved,
+}
+
+// ToMultibootMmap converts MemoryMap to a multiboot memory map.
+//
+// Range types without a multiboot equivalent are marked reserved.
+func (mm MemoryMap) ToMultibootMmap() MultibootMmap {
+	var m MultibootMmap
+	for _, entry := range mm {
+		typ, ok := rangeTypeToMultibootMmapType[entry.Type]
+		if !ok {
+			typ = MultibootMmapTypeReserved
+		}
+		m = append(m, MultibootMmapEntry{
+			// Size does not include the Size field itself.
+			Size:     uint32(binary.Size(MultibootMmapEntry{})) - 4,
+			BaseAddr: uint64(entry.Start),
+			Length:   uint64(entry.Size),
+			Type:     typ,
+		})
+	}
+	return m
+}
+
+// Marshal returns the packed little-endian bytes of m, as expected at
+// mmap_addr by multiboot kernels.
+func (m MultibootMmap) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, m); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var procIOMem = "/proc/iomem"
+
 // MemoryMapFromIOMem reads the kernel-maintained memory map from /proc/iomem.
+//
+// Only top-level ranges are recorded; see MemoryMapFromIOMemWithChildren.
+// Reservations that /proc/iomem nests inside "System RAM", e.g. the
+// kernel's own code and data, are therefore not carved out but count as
+// RAM, so the result must not be used to place segments.
 func MemoryMapFromIOMem() (MemoryMap, error) {
-	return memoryMapFromIOMemFile("/proc/iomem")
+	return memoryMapFromIOMemFile(procIOMem, false)
 }
 
 func rangeType(s string) RangeType {
@@ -366,107 +918,157 @@ func rangeType(s string) RangeType {
 	return RangeType(s)
 }
 
-func memoryMapFromIOMem(r io.Reader) (MemoryMap, error) {
+// isEmptyInclusiveRange reports whether the inclusive interval [start, end]
+// read from a kernel or firmware table denotes an empty range.
+//
+// Strictly, [start, end] with start == end is one byte long. But an inclusive
+// end cannot express an empty range, so Linux and firmware tables print
+// empty ones, e.g. unset BARs or reservations, as "000-000" or more generally
+// start == end. One-byte ranges do not occur in these tables, so every parser
+// of inclusive intervals treats start == end as empty.
+func isEmptyInclusiveRange(start, end uintptr) bool {
+	return start == end
+}
+
+// ParseIOMemLine parses a line of /proc/iomem such as
+//
+//	740100000000-7401001fffff : PCI Bus 0001:01
+//
+// It returns false if the line is malformed or describes an empty range.
+func ParseIOMemLine(line string) (*TypedRange, bool) {
+	// Names may contain colons, e.g. PCI addresses; addresses do not.
+	addrRange, typ, ok := strings.Cut(line, ":")
+	if !ok {
+		return nil, false
+	}
+	typ = strings.TrimSpace(typ)
+	addrs := strings.Split(strings.TrimSpace(addrRange), "-")
+	if len(addrs) != 2 {
+		return nil, false
+	}
+	start, err := strconv.ParseUint(addrs[0], 16, 64)
+	if err != nil {
+		return nil, false
+	}
+	end, err := strconv.ParseUint(addrs[1], 16, 64)
+	if err != nil {
+		return nil, false
+	}
+	// Reversed ranges, and ranges whose size does not fit a Range, can
+	// only come from corrupted input.
+	if end < start || end > uint64(MaxAddr) || end-start >= uint64(^uint(0)) {
+		return nil, false
+	}
+	if isEmptyInclusiveRange(uintptr(start), uintptr(end)) {
+		return nil, false
+	}
+	return &TypedRange{
+		Range: RangeFromInclusiveInterval(uintptr(start), uintptr(end)),
+		Type:  rangeType(typ),
+	}, true
+}
+
+// MemoryMapFromIOMemWithChildren reads a memory map in the format of
+// /proc/iomem from r, including the nested ranges that /proc/iomem indents
+// below their parents, e.g. "Kernel code" or reserved ranges within
+// "System RAM". Children are carved out of their parents, as with Insert.
+//
+// MemoryMapFromIOMem only records the top-level ranges.
+func MemoryMapFromIOMemWithChildren(r io.Reader) (MemoryMap, error) {
+	return memoryMapFromIOMem(r, true)
+}
+
+// memoryMapFromIOMem parses /proc/iomem from r. Unless children is true,
+// only top-level, i.e. unindented, ranges are recorded.
+func memoryMapFromIOMem(r io.Reader, children bool) (MemoryMap, error) {
 	var mm MemoryMap
 	b := bufio.NewScanner(r)
 	for b.Scan() {
-		// Format:
-		//   740100000000-7401001fffff : PCI Bus 0001:01
-		els := strings.Split(b.Text(), ":")
-		if len(els) != 2 {
+		line := b.Text()
+		if !children && strings.TrimLeft(line, " \t") != line {
 			continue
 		}
-		typ := strings.TrimSpace(els[1])
-		addrs := strings.Split(strings.TrimSpace(els[0]), "-")
-		if len(addrs) != 2 {
+		tr, ok := ParseIOMemLine(line)
+		if !ok {
 			continue
 		}
-		start, err := strconv.ParseUint(addrs[0], 16, 64)
-		if err != nil {
-			continue
-		}
-		end, err := strconv.ParseUint(addrs[1], 16, 64)
-		if err != nil {
-			continue
-		}
-		// Special case -- empty ranges are represented as "000-000"
-		// even though the non-inclusive end would make that a 1-sized
-		// region.
-		if start == end {
-			continue
-		}
-		mm.Insert(TypedRange{
-			Range: RangeFromInclusiveInterval(uintptr(start), uintptr(end)),
-			Type:  rangeType(typ),
-		})
+		mm.Insert(*tr)
 	}
 	if err := b.Err(); err != nil {
 		return nil, err
 	}
 	mm.sort()
-	mm.mergeAdjacent()
+	mm.Merge()
 	return mm, nil
 }
 
-func memoryMapFromIOMemFile(path string) (MemoryMap, error) {
+func memoryMapFromIOMemFile(path string, children bool) (MemoryMap, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		return nil, err
+		return nil, sourceError(path, err)
 	}
 	defer f.Close()
 
-	return memoryMapFromIOMem(f)
+	return memoryMapFromIOMem(f, children)
 }
 
-func rangeFromMemblockLine(s string) *Range {
-	// Format:
-	//    0: 0x0000004000000000..0x00000040113fffff
+// ParseMemblockLine parses a line of /sys/kernel/debug/memblock/memory or
+// /sys/kernel/debug/memblock/reserved such as
+//
+//	0: 0x0000004000000000..0x00000040113fffff
+//
+// It returns false if the line is malformed or describes an empty range.
+func ParseMemblockLine(s string) (*Range, bool) {
 	els := strings.Split(s, ":")
 	if len(els) != 2 {
-		return nil
+		return nil, false
 	}
 	addrs := strings.Split(strings.TrimSpace(els[1]), "..")
 	if len(addrs) != 2 {
-		return nil
+		return nil, false
 	}
 	startS, _ := strings.CutPrefix(addrs[0], "0x")
 	start, err := strconv.ParseUint(startS, 16, 64)
 	if err != nil {
-		return nil
+		return nil, false
 	}
 	endS, _ := strings.CutPrefix(addrs[1], "0x")
 	end, err := strconv.ParseUint(endS, 16, 64)
 	if err != nil {
-		return nil
+		return nil, false
 	}
 
-	// Special case -- empty ranges are represented as "000-000"
-	// even though the non-inclusive end would make that a 1-sized
-	// region.
-	if start == end {
-		return nil
+	// Reversed ranges, and ranges whose size does not fit a Range, can
+	// only come from corrupted input.
+	if end < start || end > uint64(MaxAddr) || end-start >= uint64(^uint(0)) {
+		return nil, false
+	}
+	if isEmptyInclusiveRange(uintptr(start), uintptr(end)) {
+		return nil, false
 	}
 
 	// end is inclusive.
 	r := RangeFromInclusiveInterval(uintptr(start), uintptr(end))
-	return &r
+	return &r, true
 }
 
+var memblockRoot = "/sys/kernel/debug/memblock"
+
 // MemoryMapFromMemblock reads a kernel-maintained memory map from /sys/kernel/debug/memblock.
 //
 // memblock is only available on kernels with CONFIG_ARCH_KEEP_MEMBLOCK (and
 // debugfs). Without it, the kernel only maintains memblock early during init
 // as its memory allocation mechanism.
 func MemoryMapFromMemblock() (MemoryMap, error) {
-	m, err := os.Open("/sys/kernel/debug/memblock/memory")
+	m, err := os.Open(filepath.Join(memblockRoot, "memory"))
 	if err != nil {
-		return nil, err
+		return nil, sourceError("memblock", err)
 	}
 	defer m.Close()
 
-	r, err := os.Open("/sys/kernel/debug/memblock/reserved")
+	r, err := os.Open(filepath.Join(memblockRoot, "reserved"))
 	if err != nil {
-		return nil, err
+		return nil, sourceError("memblock", err)
 	}
 	defer r.Close()
 
@@ -475,12 +1077,14 @@ func MemoryMapFromMemblock() (MemoryMap, error) {
 
 func memoryMapFromMemblock(memory io.Reader, reserved io.Reader) (MemoryMap, error) {
 	var mm MemoryMap
+	var ram Ranges
 	b := bufio.NewScanner(memory)
 	for b.Scan() {
-		r := rangeFromMemblockLine(b.Text())
-		if r == nil {
+		r, ok := ParseMemblockLine(b.Text())
+		if !ok {
 			continue
 		}
+		ram = append(ram, *r)
 		mm.Insert(TypedRange{
 			Range: *r,
 			Type:  RangeRAM,
@@ -492,10 +1096,17 @@ func memoryMapFromMemblock(memory io.Reader, reserved io.Reader) (MemoryMap, err
 
 	b = bufio.NewScanner(reserved)
 	for b.Scan() {
-		r := rangeFromMemblockLine(b.Text())
-		if r == nil {
+		r, ok := ParseMemblockLine(b.Text())
+		if !ok {
 			continue
 		}
+		// memblock only reserves memory it knows about. A reserved
+		// range outside of all memory ranges may be legitimate, but
+		// on some kernels it means the two files were printed in
+		// different units or formats and we misparsed one of them.
+		if !ram.Overlaps(*r) {
+			log.Printf("memblock reserved range %s is outside of all memory ranges; memblock output may have been misparsed", r)
+		}
 		mm.Insert(TypedRange{
 			Range: *r,
 			Type:  RangeReserved,
@@ -505,6 +1116,37 @@ func memoryMapFromMemblock(memory io.Reader, reserved io.Reader) (MemoryMap, err
 		return nil, err
 	}
 	mm.sort()
-	mm.mergeAdjacent()
+	mm.Merge()
 	return mm, nil
 }
+
+// MemoryMapFromSystem returns the memory map of the running system, read
+// from the first of these sources that yields a non-empty map:
+//
+//   - /sys/firmware/memmap, the map the firmware (e.g. EFI) handed off;
+//   - /proc/iomem, which only shows addresses to root, with the reservations
+//     nested in its ranges carved out (see MemoryMapFromIOMemWithChildren);
+//   - /sys/kernel/debug/memblock.
+//
+// If all of them fail, the returned error joins the errors of all sources.
+func MemoryMapFromSystem() (MemoryMap, error) {
+	var errs []error
+	for _, src := range []struct {
+		name string
+		read func() (MemoryMap, error)
+	}{
+		{"sysfs memmap", MemoryMapFromSysfsMemmap},
+		{"iomem", func() (MemoryMap, error) { return memoryMapFromIOMemFile(procIOMem, true) }},
+		{"memblock", MemoryMapFromMemblock},
+	} {
+		mm, err := src.read()
+		if err == nil && len(mm) == 0 {
+			err = fmt.Errorf("%w: %s memory map is empty", ErrSourceUnavailable, src.name)
+		}
+		if err == nil {
+			return mm, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
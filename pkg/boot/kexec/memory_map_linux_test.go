@@ -5,12 +5,18 @@
 package kexec
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io/fs"
+	"log"
+	"math/rand"
 	"os"
 	"path"
 	"reflect"
 	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/u-root/u-root/pkg/dt"
 )
@@ -80,6 +86,48 @@ func TestMemoryMapFromFDT(t *testing.T) {
 			},
 			nil,
 		},
+		{
+			"overlapping and adjacent memory nodes are merged",
+			&dt.FDT{
+				RootNode: &dt.Node{
+					Name: "/",
+					Children: []*dt.Node{
+						{
+							Name: "memory@10000000",
+							Properties: []dt.Property{
+								{Name: "device_type", Value: append([]byte("memory"), 0)},
+								{Name: "reg", Value: []byte{0x0, 0x0, 0x0, 0x0, 0x10, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x20, 0x0, 0x0, 0x0}},
+							},
+						},
+						{
+							Name: "memory@0",
+							Properties: []dt.Property{
+								{Name: "device_type", Value: append([]byte("memory"), 0)},
+								{Name: "reg", Value: []byte{0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x20, 0x0, 0x0, 0x0}},
+							},
+						},
+						{
+							Name: "memory@0 again",
+							Properties: []dt.Property{
+								{Name: "device_type", Value: append([]byte("memory"), 0)},
+								{Name: "reg", Value: []byte{0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x20, 0x0, 0x0, 0x0}},
+							},
+						},
+						{
+							Name: "memory@30000000",
+							Properties: []dt.Property{
+								{Name: "device_type", Value: append([]byte("memory"), 0)},
+								{Name: "reg", Value: []byte{0x0, 0x0, 0x0, 0x0, 0x30, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x10, 0x0, 0x0, 0x0}},
+							},
+						},
+					},
+				},
+			},
+			MemoryMap{
+				TypedRange{Range{Start: uintptr(0x0), Size: 0x40000000}, "System RAM"},
+			},
+			nil,
+		},
 		{
 			"add system memory, and reserved memory ok",
 			&dt.FDT{
@@ -208,6 +256,46 @@ func TestMemoryMapFromFDT(t *testing.T) {
 	}
 }
 
+func TestMemoryMapFromDeviceTreeFS(t *testing.T) {
+	// A trimmed /proc/device-tree from an arm64 QEMU virt machine with
+	// a CMA pool. Property files hold the raw big-endian values.
+	fsys := fstest.MapFS{
+		"#address-cells":                       {Data: []byte{0, 0, 0, 2}},
+		"#size-cells":                          {Data: []byte{0, 0, 0, 2}},
+		"compatible":                           {Data: []byte("linux,dummy-virt\x00")},
+		"name":                                 {Data: []byte("\x00")},
+		"chosen/bootargs":                      {Data: []byte("console=ttyAMA0\x00")},
+		"cpus/cpu@0/device_type":               {Data: []byte("cpu\x00")},
+		"cpus/cpu@0/reg":                       {Data: []byte{0, 0, 0, 0}},
+		"memory@40000000/device_type":          {Data: []byte("memory\x00")},
+		"memory@40000000/name":                 {Data: []byte("memory\x00")},
+		"memory@40000000/reg":                  {Data: []byte{0, 0, 0, 0, 0x40, 0, 0, 0, 0, 0, 0, 0, 0x80, 0, 0, 0}},
+		"reserved-memory/#address-cells":       {Data: []byte{0, 0, 0, 2}},
+		"reserved-memory/#size-cells":          {Data: []byte{0, 0, 0, 2}},
+		"reserved-memory/ranges":               {Data: nil},
+		"reserved-memory/linux,cma/compatible": {Data: []byte("shared-dma-pool\x00")},
+		"reserved-memory/linux,cma/reg":        {Data: []byte{0, 0, 0, 0, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0x04, 0, 0, 0}},
+		"reserved-memory/linux,cma/reusable":   {Data: nil},
+	}
+	want := MemoryMap{
+		TypedRange{Range: Range{Start: 0x40000000, Size: 0x78000000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0xb8000000, Size: 0x4000000}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 0xbc000000, Size: 0x4000000}, Type: RangeRAM},
+	}
+
+	got, err := memoryMapFromDeviceTreeFS(fsys)
+	if err != nil {
+		t.Fatalf("memoryMapFromDeviceTreeFS() = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("memoryMapFromDeviceTreeFS() =\n%v, want\n%v", got, want)
+	}
+
+	if _, err := memoryMapFromDeviceTreeFS(fstest.MapFS{"memory/reg": {Data: []byte{1, 2, 3}}, "memory/device_type": {Data: []byte("memory\x00")}}); !errors.Is(err, dt.ErrPropertyRegionInvalid) {
+		t.Errorf("memoryMapFromDeviceTreeFS(short reg) = %v, want %v", err, dt.ErrPropertyRegionInvalid)
+	}
+}
+
 func TestMemoryMapFromSysfsMemmap(t *testing.T) {
 	root := t.TempDir()
 
@@ -237,12 +325,20 @@ func TestMemoryMapFromSysfsMemmap(t *testing.T) {
 	if err := create("3", 300, 349, RangeReserved); err != nil {
 		t.Fatal(err)
 	}
+	if err := create("4", 400, 449, RangePersistent); err != nil {
+		t.Fatal(err)
+	}
+	if err := create("5", 500, 549, RangePersistentLegacy); err != nil {
+		t.Fatal(err)
+	}
 
 	want := MemoryMap{
 		{Range: Range{Start: 0, Size: 50}, Type: RangeRAM},
 		{Range: Range{Start: 100, Size: 50}, Type: RangeACPI},
 		{Range: Range{Start: 200, Size: 50}, Type: RangeNVS},
 		{Range: Range{Start: 300, Size: 50}, Type: RangeReserved},
+		{Range: Range{Start: 400, Size: 50}, Type: RangePersistent},
+		{Range: Range{Start: 500, Size: 50}, Type: RangePersistentLegacy},
 	}
 
 	phys, err := memoryMapFromSysfsMemmap(root)
@@ -275,142 +371,1324 @@ func TestToUEFIPayloadMemoryMap(t *testing.T) {
 	}
 }
 
-func TestMemoryMapInsert(t *testing.T) {
-	for i, tt := range []struct {
-		mm   MemoryMap
-		r    TypedRange
-		want MemoryMap
+func TestToMultibootMmap(t *testing.T) {
+	mm := MemoryMap{
+		TypedRange{Range: Range{Start: 0, Size: 50}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 100, Size: 50}, Type: RangeACPI},
+		TypedRange{Range: Range{Start: 200, Size: 50}, Type: RangeNVS},
+		TypedRange{Range: Range{Start: 300, Size: 50}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 400, Size: 50}, Type: RangeDefault},
+		TypedRange{Range: Range{Start: 500, Size: 50}, Type: RangeType("Kernel code")},
+	}
+	want := MultibootMmap{
+		{Size: 20, BaseAddr: 0, Length: 50, Type: MultibootMmapTypeAvailable},
+		{Size: 20, BaseAddr: 100, Length: 50, Type: MultibootMmapTypeACPIReclaimable},
+		{Size: 20, BaseAddr: 200, Length: 50, Type: MultibootMmapTypeNVS},
+		{Size: 20, BaseAddr: 300, Length: 50, Type: MultibootMmapTypeReserved},
+		{Size: 20, BaseAddr: 400, Length: 50, Type: MultibootMmapTypeReserved},
+		{Size: 20, BaseAddr: 500, Length: 50, Type: MultibootMmapTypeReserved},
+	}
+	m := mm.ToMultibootMmap()
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("ToMultibootMmap() got %v, want %v", m, want)
+	}
+
+	b, err := m[:1].Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() error: %v", err)
+	}
+	wantBytes := []byte{
+		20, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0,
+		50, 0, 0, 0, 0, 0, 0, 0,
+		1, 0, 0, 0,
+	}
+	if !bytes.Equal(b, wantBytes) {
+		t.Errorf("Marshal() = %v, want %v", b, wantBytes)
+	}
+}
+
+func TestMemoryMapRemoveType(t *testing.T) {
+	mm := MemoryMap{
+		TypedRange{Range: Range{Start: 0, Size: 50}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 50, Size: 50}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 100, Size: 50}, Type: RangeACPI},
+		TypedRange{Range: Range{Start: 150, Size: 50}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 200, Size: 50}, Type: RangeRAM},
+	}
+	orig := append(MemoryMap(nil), mm...)
+
+	want := MemoryMap{
+		TypedRange{Range: Range{Start: 0, Size: 50}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 100, Size: 50}, Type: RangeACPI},
+		TypedRange{Range: Range{Start: 200, Size: 50}, Type: RangeRAM},
+	}
+	if got := mm.RemoveType(RangeReserved); !reflect.DeepEqual(got, want) {
+		t.Errorf("RemoveType(%v) = %v, want %v", RangeReserved, got, want)
+	}
+	if got := mm.RemoveType(RangeNVS); !reflect.DeepEqual(got, mm) {
+		t.Errorf("RemoveType(%v) = %v, want %v", RangeNVS, got, mm)
+	}
+	if !reflect.DeepEqual(mm, orig) {
+		t.Errorf("RemoveType modified the memory map: got %v, want %v", mm, orig)
+	}
+}
+
+func TestMemoryMapClone(t *testing.T) {
+	mm := MemoryMap{
+		TypedRange{Range: Range{Start: 0, Size: 0x2000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x2000, Size: 0x1000}, Type: RangeReserved},
+	}
+	orig := MemoryMap{
+		TypedRange{Range: Range{Start: 0, Size: 0x2000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x2000, Size: 0x1000}, Type: RangeReserved},
+	}
+
+	c := mm.Clone()
+	if !reflect.DeepEqual(c, mm) {
+		t.Errorf("Clone() = %v, want %v", c, mm)
+	}
+	c.Insert(TypedRange{Range: Range{Start: 0x100, Size: 0x100}, Type: RangeReserved})
+	c[0].Type = RangeNVS
+	if !reflect.DeepEqual(mm, orig) {
+		t.Errorf("modifying the clone modified the original: got %v, want %v", mm, orig)
+	}
+
+	if c := MemoryMap(nil).Clone(); c != nil {
+		t.Errorf("Clone() of nil map = %v, want nil", c)
+	}
+}
+
+func TestFindCrashKernelRegion(t *testing.T) {
+	mm := MemoryMap{
+		TypedRange{Range: Range{Start: 0, Size: 0x100000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x100000, Size: 0x100000}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 0x200000, Size: 0x3000000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x100000000, Size: 0x100000000}, Type: RangeRAM},
+	}
+	for _, tt := range []struct {
+		name  string
+		size  uint
+		align uint
+		below uintptr
+		want  Range
+		err   error
 	}{
 		{
-			// r is entirely within m's one range.
-			mm: MemoryMap{
-				TypedRange{Range: Range{Start: 0, Size: 0x2000}, Type: RangeRAM},
-			},
-			r: TypedRange{Range: Range{Start: 0x100, Size: 0x100}, Type: RangeReserved},
-			want: MemoryMap{
-				TypedRange{Range: Range{Start: 0, Size: 0x100}, Type: RangeRAM},
-				TypedRange{Range: Range{Start: 0x100, Size: 0x100}, Type: RangeReserved},
-				TypedRange{Range: Range{Start: 0x200, Size: 0x2000 - 0x200}, Type: RangeRAM},
-			},
+			name:  "fits below 4G",
+			size:  0x1000000,
+			align: 0x1000000,
+			below: 0x100000000,
+			want:  Range{Start: 0x1000000, Size: 0x1000000},
 		},
 		{
-			// r sits across three RAM ranges.
-			mm: MemoryMap{
-				TypedRange{Range: Range{Start: 0, Size: 0x150}, Type: RangeRAM},
-				TypedRange{Range: Range{Start: 0x150, Size: 0x50}, Type: RangeRAM},
-				TypedRange{Range: Range{Start: 0x1a0, Size: 0x100}, Type: RangeRAM},
-			},
-			r: TypedRange{Range: Range{Start: 0x100, Size: 0x100}, Type: RangeReserved},
-			want: MemoryMap{
-				TypedRange{Range: Range{Start: 0, Size: 0x100}, Type: RangeRAM},
-				TypedRange{Range: Range{Start: 0x100, Size: 0x100}, Type: RangeReserved},
-				TypedRange{Range: Range{Start: 0x200, Size: 0xa0}, Type: RangeRAM},
-			},
+			name:  "unaligned",
+			size:  0x80000,
+			below: 0x100000000,
+			want:  Range{Start: 0, Size: 0x80000},
 		},
 		{
-			// r is a superset of the ranges in m.
-			mm: MemoryMap{
-				TypedRange{Range: Range{Start: 0x100, Size: 0x50}, Type: RangeRAM},
-			},
-			r: TypedRange{Range: Range{Start: 0x100, Size: 0x100}, Type: RangeReserved},
-			want: MemoryMap{
-				TypedRange{Range: Range{Start: 0x100, Size: 0x100}, Type: RangeReserved},
-			},
+			name:  "cap too low",
+			size:  0x1000000,
+			align: 0x1000000,
+			below: 0x1800000,
+			err:   ErrNotEnoughSpace,
 		},
 		{
-			// r is the first range in the map.
-			mm: MemoryMap{},
-			r:  TypedRange{Range: Range{Start: 0x100, Size: 0x100}, Type: RangeReserved},
-			want: MemoryMap{
-				TypedRange{Range: Range{Start: 0x100, Size: 0x100}, Type: RangeReserved},
-			},
+			name:  "too large below 4G",
+			size:  0x10000000,
+			below: 0x100000000,
+			err:   ErrNotEnoughSpace,
+		},
+		{
+			name: "no cap",
+			size: 0x10000000,
+			want: Range{Start: 0x100000000, Size: 0x10000000},
 		},
 	} {
-		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
-			// Make a copy for the Errorf print.
-			mm := tt.mm
-			tt.mm.Insert(tt.r)
-
-			if !reflect.DeepEqual(tt.mm, tt.want) {
-				t.Errorf("\n%v.Insert(%s) =\n%v, want\n%v", mm, tt.r, tt.mm, tt.want)
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mm.FindCrashKernelRegion(tt.size, tt.align, tt.below)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("FindCrashKernelRegion() error = %v, want %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("FindCrashKernelRegion() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
 
-func TestMemoryMapFromIOMem(t *testing.T) {
-	f := `10000000-101fffff : reserved
-10201000-10202fff : reserved
-14000000-1effffff : System RAM
-  14154000-14154fff : reserved
-  141c0000-14bcffff : reserved
-  14c10000-1636ffff : Kernel code
-  16370000-1686ffff : reserved
-  16870000-1734ffff : Kernel data
-  17350000-17377fff : reserved`
-	mm, err := memoryMapFromIOMem(strings.NewReader(f))
-	if err != nil {
-		t.Fatal(err)
+func TestFindSpaceTopDown(t *testing.T) {
+	mm := MemoryMap{
+		TypedRange{Range: Range{Start: 0, Size: 0x100000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x100000, Size: 0x100000}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 0x200400, Size: 0x1400}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x201800, Size: 0x800}, Type: RangeACPI},
+	}
+	for _, tt := range []struct {
+		size, align uint
+		want        uintptr
+		wantErr     error
+	}{
+		{size: 0x1000, want: 0x200800},
+		{size: 0x1000, align: 0x400, want: 0x200800},
+		// Does not fit at the top once aligned, so falls to low memory.
+		{size: 0x1000, align: 0x1000, want: 0xff000},
+		{size: 0x2000, want: 0xfe000},
+		{size: 0x200000, wantErr: ErrNotEnoughSpace},
+	} {
+		got, err := mm.FindSpaceTopDown(tt.size, tt.align)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("FindSpaceTopDown(%#x, %#x) = %v, want %v", tt.size, tt.align, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("FindSpaceTopDown(%#x, %#x) = %#x, want %#x", tt.size, tt.align, got, tt.want)
+		}
+	}
+}
+
+func TestReserveLowMemory(t *testing.T) {
+	mm := MemoryMap{
+		TypedRange{Range: Range{Start: 0x1000, Size: 0x9e000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x9f000, Size: 0x1000}, Type: RangeACPI},
+		TypedRange{Range: Range{Start: 0xe0000, Size: 0x40000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x200000, Size: 0x100000}, Type: RangeRAM},
+	}
+
+	// Limit 0 leaves the map alone.
+	got := mm.Clone()
+	got.ReserveLowMemory(0)
+	if !reflect.DeepEqual(got, mm) {
+		t.Errorf("ReserveLowMemory(0) = %v, want %v", got, mm)
 	}
 
+	got = mm.Clone()
+	got.ReserveLowMemory(0x100000)
 	want := MemoryMap{
-		TypedRange{Range: RangeFromInterval(0x10000000, 0x101fffff+1), Type: RangeReserved},
-		TypedRange{Range: RangeFromInterval(0x10201000, 0x10202fff+1), Type: RangeReserved},
-		TypedRange{Range: RangeFromInterval(0x14000000, 0x14154000), Type: RangeRAM},
-		TypedRange{Range: RangeFromInterval(0x14154000, 0x14154fff+1), Type: RangeReserved},
-		TypedRange{Range: RangeFromInterval(0x14155000, 0x141c0000), Type: RangeRAM},
-		TypedRange{Range: RangeFromInterval(0x141c0000, 0x14bcffff+1), Type: RangeReserved},
-		TypedRange{Range: RangeFromInterval(0x14bd0000, 0x14c10000), Type: RangeRAM},
-		TypedRange{Range: RangeFromInterval(0x14c10000, 0x1636ffff+1), Type: RangeType("Kernel code")},
-		TypedRange{Range: RangeFromInterval(0x16370000, 0x1686ffff+1), Type: RangeReserved},
-		TypedRange{Range: RangeFromInterval(0x16870000, 0x1734ffff+1), Type: RangeType("Kernel data")},
-		TypedRange{Range: RangeFromInterval(0x17350000, 0x17377fff+1), Type: RangeReserved},
-		TypedRange{Range: RangeFromInterval(0x17378000, 0x1effffff+1), Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x1000, Size: 0x9e000}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 0x9f000, Size: 0x1000}, Type: RangeACPI},
+		TypedRange{Range: Range{Start: 0xe0000, Size: 0x20000}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 0x100000, Size: 0x20000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x200000, Size: 0x100000}, Type: RangeRAM},
 	}
-	if !reflect.DeepEqual(mm, want) {
-		t.Errorf("Not equal, got %v", mm)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReserveLowMemory(0x100000) = %v, want %v", got, want)
 	}
 
-	ignored := `00000000-00000000 : reserved
-10000000-101fffff
-10201000 : reserved
-: System RAM
-  141GGGGG-14154fff : reserved
-  141c0000-14GGGGGG : reserved`
-	mm2, err := memoryMapFromIOMem(strings.NewReader(ignored))
+	// Before, the lowest fit is at the bottom of RAM; after, nothing
+	// below the limit is handed out.
+	if r, err := mm.RAM().FindSpace(0x1000); err != nil || r.Start != 0x1000 {
+		t.Errorf("FindSpace before ReserveLowMemory = %v, %v, want start 0x1000", r, err)
+	}
+	r, err := got.RAM().FindSpace(0x1000)
 	if err != nil {
-		t.Fatal(err)
+		t.Fatalf("FindSpace after ReserveLowMemory = %v", err)
+	}
+	if r.Start < 0x100000 {
+		t.Errorf("FindSpace after ReserveLowMemory = %v, want start >= 0x100000", r)
 	}
+	if _, err := got.RAM().FindSpace(0x40000, WithinRange(RangeFromInterval(0, 0x200000))); !errors.Is(err, ErrNotEnoughSpace) {
+		t.Errorf("FindSpace(0x40000) below 2MiB after ReserveLowMemory = %v, want %v", err, ErrNotEnoughSpace)
+	}
+}
 
-	if want := MemoryMap(nil); !reflect.DeepEqual(mm2, want) {
-		t.Errorf("Memory maps not equal, got %v, want %v", mm2, want)
+func TestDiffMemoryMaps(t *testing.T) {
+	old := MemoryMap{
+		TypedRange{Range: Range{Start: 0, Size: 0x9f000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x9f000, Size: 0x61000}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 0x100000, Size: 0x7ff00000}, Type: RangeRAM},
+	}
+	for _, tt := range []struct {
+		name        string
+		cur         MemoryMap
+		wantAdded   MemoryMap
+		wantRemoved MemoryMap
+	}{
+		{
+			name: "unchanged",
+			cur:  old,
+		},
+		{
+			name: "hotplug add",
+			cur: MemoryMap{
+				TypedRange{Range: Range{Start: 0, Size: 0x9f000}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0x9f000, Size: 0x61000}, Type: RangeReserved},
+				TypedRange{Range: Range{Start: 0x100000, Size: 0x7ff00000}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0x100000000, Size: 0x200000000}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0x300000000, Size: 0x200000000}, Type: RangeRAM},
+			},
+			wantAdded: MemoryMap{
+				TypedRange{Range: Range{Start: 0x100000000, Size: 0x400000000}, Type: RangeRAM},
+			},
+		},
+		{
+			name: "hotplug add merged into existing RAM",
+			cur: MemoryMap{
+				TypedRange{Range: Range{Start: 0, Size: 0x9f000}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0x9f000, Size: 0x61000}, Type: RangeReserved},
+				TypedRange{Range: Range{Start: 0x100000, Size: 0xfff00000}, Type: RangeRAM},
+			},
+			wantAdded: MemoryMap{
+				TypedRange{Range: Range{Start: 0x80000000, Size: 0x80000000}, Type: RangeRAM},
+			},
+		},
+		{
+			name: "remove and retype",
+			cur: MemoryMap{
+				TypedRange{Range: Range{Start: 0, Size: 0x9f000}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0x9f000, Size: 0x61000}, Type: RangeReserved},
+				TypedRange{Range: Range{Start: 0x100000, Size: 0x3ff00000}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0x40000000, Size: 0x1000}, Type: RangeACPI},
+			},
+			wantAdded: MemoryMap{
+				TypedRange{Range: Range{Start: 0x40000000, Size: 0x1000}, Type: RangeACPI},
+			},
+			wantRemoved: MemoryMap{
+				TypedRange{Range: Range{Start: 0x40000000, Size: 0x40000000}, Type: RangeRAM},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			added, removed := DiffMemoryMaps(old, tt.cur)
+			if !reflect.DeepEqual(added, tt.wantAdded) {
+				t.Errorf("added = %v, want %v", added, tt.wantAdded)
+			}
+			if !reflect.DeepEqual(removed, tt.wantRemoved) {
+				t.Errorf("removed = %v, want %v", removed, tt.wantRemoved)
+			}
+		})
 	}
 }
 
-func TestMemoryMapFromMemblock(t *testing.T) {
-	memory := `  0: 0x0000004000000000..0x00000040113fffff
-   1: 0x0000004011400000..0x00000040123fffff
-   2: 0x0000004012400000..0x00000040dfffffff
-   3: 0x0000004400000000..0x00000044dfffffff`
-	reserved := `  0: 0x0000004000000000..0x00000040113fffff
-   1: 0x0000004012400000..0x00000040125fffff
-   2: 0x0000004012800000..0x00000040137fffff`
-	mm, err := memoryMapFromMemblock(strings.NewReader(memory), strings.NewReader(reserved))
-	if err != nil {
-		t.Fatal(err)
+func TestMemoryMapSplitAt(t *testing.T) {
+	mm := MemoryMap{
+		TypedRange{Range: Range{Start: 0, Size: 0x9f000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x9f000, Size: 0x61000}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 0x100000, Size: 0xbff00000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0xfec00000, Size: 0x1000}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 0x100000000, Size: 0x40000000}, Type: RangeRAM},
+	}
+	for _, tt := range []struct {
+		name      string
+		addr      uintptr
+		wantBelow MemoryMap
+		wantAbove MemoryMap
+	}{
+		{
+			name:      "at 0",
+			addr:      0,
+			wantAbove: mm,
+		},
+		{
+			name:      "above everything",
+			addr:      MaxAddr,
+			wantBelow: mm,
+		},
+		{
+			name:      "on a boundary",
+			addr:      0x100000,
+			wantBelow: mm[:2],
+			wantAbove: mm[2:],
+		},
+		{
+			name: "straddling",
+			addr: 0x80000000,
+			wantBelow: MemoryMap{
+				TypedRange{Range: Range{Start: 0, Size: 0x9f000}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0x9f000, Size: 0x61000}, Type: RangeReserved},
+				TypedRange{Range: Range{Start: 0x100000, Size: 0x7ff00000}, Type: RangeRAM},
+			},
+			wantAbove: MemoryMap{
+				TypedRange{Range: Range{Start: 0x80000000, Size: 0x40000000}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0xfec00000, Size: 0x1000}, Type: RangeReserved},
+				TypedRange{Range: Range{Start: 0x100000000, Size: 0x40000000}, Type: RangeRAM},
+			},
+		},
+		{
+			name: "one byte into a range",
+			addr: 0xfec00001,
+			wantBelow: MemoryMap{
+				TypedRange{Range: Range{Start: 0, Size: 0x9f000}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0x9f000, Size: 0x61000}, Type: RangeReserved},
+				TypedRange{Range: Range{Start: 0x100000, Size: 0xbff00000}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0xfec00000, Size: 0x1}, Type: RangeReserved},
+			},
+			wantAbove: MemoryMap{
+				TypedRange{Range: Range{Start: 0xfec00001, Size: 0xfff}, Type: RangeReserved},
+				TypedRange{Range: Range{Start: 0x100000000, Size: 0x40000000}, Type: RangeRAM},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			orig := mm.Clone()
+			below, above := mm.SplitAt(tt.addr)
+			if !reflect.DeepEqual(below, tt.wantBelow) {
+				t.Errorf("SplitAt(%#x) below = %v, want %v", tt.addr, below, tt.wantBelow)
+			}
+			if !reflect.DeepEqual(above, tt.wantAbove) {
+				t.Errorf("SplitAt(%#x) above = %v, want %v", tt.addr, above, tt.wantAbove)
+			}
+			if !reflect.DeepEqual(mm, orig) {
+				t.Errorf("SplitAt(%#x) modified the map: %v", tt.addr, mm)
+			}
+		})
 	}
+}
 
-	want := MemoryMap{
-		TypedRange{Range: RangeFromInterval(0x4000000000, 0x4011400000), Type: RangeReserved},
-		TypedRange{Range: RangeFromInterval(0x4011400000, 0x4012400000), Type: RangeRAM},
-		TypedRange{Range: RangeFromInterval(0x4012400000, 0x4012600000), Type: RangeReserved},
-		TypedRange{Range: RangeFromInterval(0x4012600000, 0x4012800000), Type: RangeRAM},
-		TypedRange{Range: RangeFromInterval(0x4012800000, 0x4013800000), Type: RangeReserved},
-		TypedRange{Range: RangeFromInterval(0x4013800000, 0x40e0000000), Type: RangeRAM},
-		TypedRange{Range: RangeFromInterval(0x4400000000, 0x44e0000000), Type: RangeRAM},
+func TestMemoryMapUsableRAMBelow(t *testing.T) {
+	mm := MemoryMap{
+		TypedRange{Range: Range{Start: 0, Size: 0x9f000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x9f000, Size: 0x61000}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 0x100000, Size: 0xbff00000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0xc0000000, Size: 0x1000000}, Type: RangeDefault},
+		TypedRange{Range: Range{Start: 0xfec00000, Size: 0x1000}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 0xff000000, Size: 0x2000000}, Type: RangeRAM},
 	}
-	if !reflect.DeepEqual(mm, want) {
-		t.Errorf("Not equal, got %v", mm)
+	for _, tt := range []struct {
+		addr uintptr
+		want uint64
+	}{
+		{addr: 0, want: 0},
+		{addr: 0x1000, want: 0x1000},
+		// The reserved hole does not count.
+		{addr: 0x100000, want: 0x9f000},
+		// Straddling a RAM range.
+		{addr: 0x80000000, want: 0x9f000 + 0x7ff00000},
+		// Default memory counts as well.
+		{addr: 0xc0800000, want: 0x9f000 + 0xbff00000 + 0x800000},
+		// The last range straddles 4GiB.
+		{addr: 0x100000000, want: 0x9f000 + 0xbff00000 + 0x1000000 + 0x1000000},
+		{addr: MaxAddr, want: 0x9f000 + 0xbff00000 + 0x1000000 + 0x2000000},
+	} {
+		if got := mm.UsableRAMBelow(tt.addr); got != tt.want {
+			t.Errorf("UsableRAMBelow(%#x) = %#x, want %#x", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryMapErrors(t *testing.T) {
+	unexpected := t.TempDir()
+	if err := os.MkdirAll(path.Join(unexpected, "0"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(unexpected, "0", "size"), []byte("0x1000\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	missing := path.Join(t.TempDir(), "missing")
+
+	for _, tt := range []struct {
+		name  string
+		parse func() (MemoryMap, error)
+		want  []error
+	}{
+		{
+			name:  "sysfs memmap missing",
+			parse: func() (MemoryMap, error) { return memoryMapFromSysfsMemmap(missing) },
+			want:  []error{ErrSourceUnavailable, fs.ErrNotExist},
+		},
+		{
+			name:  "sysfs memmap unexpected file",
+			parse: func() (MemoryMap, error) { return memoryMapFromSysfsMemmap(unexpected) },
+			want:  []error{ErrMalformed},
+		},
+		{
+			name:  "iomem missing",
+			parse: func() (MemoryMap, error) { return memoryMapFromIOMemFile(missing, false) },
+			want:  []error{ErrSourceUnavailable, fs.ErrNotExist},
+		},
+		{
+			name:  "e820 truncated",
+			parse: func() (MemoryMap, error) { return MemoryMapFromE820Bytes(make([]byte, 7)) },
+			want:  []error{ErrMalformed},
+		},
+		{
+			name:  "no coreboot table",
+			parse: func() (MemoryMap, error) { return memoryMapFromCorebootMem(bytes.NewReader(make([]byte, 0x100000))) },
+			want:  []error{ErrNoCorebootTable, ErrSourceUnavailable},
+		},
+		{
+			name: "device tree bad reg",
+			parse: func() (MemoryMap, error) {
+				return memoryMapFromDeviceTreeFS(fstest.MapFS{
+					"memory/device_type": {Data: []byte("memory\x00")},
+					"memory/reg":         {Data: []byte{1, 2, 3}},
+				})
+			},
+			want: []error{ErrMalformed, dt.ErrPropertyRegionInvalid},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.parse()
+			for _, want := range tt.want {
+				if !errors.Is(err, want) {
+					t.Errorf("got error %v, want %v", err, want)
+				}
+			}
+		})
+	}
+
+	// Other failures to open a source keep their cause, but are not
+	// reported as an unavailable source.
+	err := sourceError("/proc/iomem", fs.ErrPermission)
+	if !errors.Is(err, fs.ErrPermission) || errors.Is(err, ErrSourceUnavailable) {
+		t.Errorf("sourceError(ErrPermission) = %v, want only fs.ErrPermission", err)
+	}
+}
+
+func TestMemoryMapIsRAM(t *testing.T) {
+	mm := MemoryMap{
+		TypedRange{Range: Range{Start: 0, Size: 0x9f000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x9f000, Size: 0x61000}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 0x100000, Size: 0x100000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x200000, Size: 0x100000}, Type: RangeDefault},
+		TypedRange{Range: Range{Start: 0x300000, Size: 0x100000}, Type: RangeRAM},
+		// Hole from 0x400000 to 0x500000.
+		TypedRange{Range: Range{Start: 0x500000, Size: 0x100000}, Type: RangeRAM},
+	}
+	for _, tt := range []struct {
+		name string
+		r    Range
+		want bool
+	}{
+		{"empty", Range{Start: 0xa0000, Size: 0}, true},
+		{"inside one range", Range{Start: 0x1000, Size: 0x1000}, true},
+		{"whole range", Range{Start: 0x100000, Size: 0x100000}, true},
+		{"across RAM and Default", Range{Start: 0x180000, Size: 0x200000}, true},
+		{"overlaps reserved", Range{Start: 0x90000, Size: 0x20000}, false},
+		{"inside reserved", Range{Start: 0xa0000, Size: 0x1000}, false},
+		{"across a hole", Range{Start: 0x380000, Size: 0x200000}, false},
+		{"ends in a hole", Range{Start: 0x380000, Size: 0x100000}, false},
+		{"starts in a hole", Range{Start: 0x480000, Size: 0x100000}, false},
+		{"beyond the map", Range{Start: 0x580000, Size: 0x100000}, false},
+	} {
+		if got := mm.IsRAM(tt.r); got != tt.want {
+			t.Errorf("%s: IsRAM(%v) = %t, want %t", tt.name, tt.r, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryMapUsableTypes(t *testing.T) {
+	mm := MemoryMap{
+		TypedRange{Range: Range{Start: 0, Size: 0x9f000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x9f000, Size: 0x61000}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 0x100000, Size: 0x100000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x200000, Size: 0x100000}, Type: RangeDefault},
+		TypedRange{Range: Range{Start: 0x300000, Size: 0x100000}, Type: RangeRAM},
+	}
+
+	// By default, Default counts and merges with the RAM around it.
+	want := Ranges{
+		Range{Start: 0, Size: 0x9f000},
+		Range{Start: 0x100000, Size: 0x300000},
+	}
+	if got := mm.UsableRAM(); !reflect.DeepEqual(got, want) {
+		t.Errorf("UsableRAM() = %v, want %v", got, want)
+	}
+	if got := mm.UsableRAM(); !reflect.DeepEqual(got, mm.UsableRAM(DefaultUsableTypes()...)) {
+		t.Errorf("UsableRAM() = %v, want the same as with DefaultUsableTypes", got)
+	}
+	r, err := mm.UsableRAM().FindSpace(0x200000)
+	if err != nil || r.Start != 0x100000 {
+		t.Errorf("UsableRAM().FindSpace(0x200000) = %v, %v, want start 0x100000", r, err)
+	}
+	span := Range{Start: 0x180000, Size: 0x100000}
+	if !mm.IsRAM(span) {
+		t.Errorf("IsRAM(%v) = false, want true", span)
+	}
+	if got, want := mm.UsableRAMBelow(0x400000), uint64(0x9f000+0x300000); got != want {
+		t.Errorf("UsableRAMBelow(0x400000) = %#x, want %#x", got, want)
+	}
+
+	// With RAM alone, the Default range is a hole.
+	want = Ranges{
+		Range{Start: 0, Size: 0x9f000},
+		Range{Start: 0x100000, Size: 0x100000},
+		Range{Start: 0x300000, Size: 0x100000},
+	}
+	if got := mm.UsableRAM(RangeRAM); !reflect.DeepEqual(got, want) {
+		t.Errorf("UsableRAM(RangeRAM) = %v, want %v", got, want)
+	}
+	if _, err := mm.UsableRAM(RangeRAM).FindSpace(0x200000); !errors.Is(err, ErrNotEnoughSpace) {
+		t.Errorf("UsableRAM(RangeRAM).FindSpace(0x200000) = %v, want %v", err, ErrNotEnoughSpace)
+	}
+	if mm.IsRAM(span, RangeRAM) {
+		t.Errorf("IsRAM(%v, RangeRAM) = true, want false", span)
+	}
+	if got, want := mm.UsableRAMBelow(0x400000, RangeRAM), uint64(0x9f000+0x200000); got != want {
+		t.Errorf("UsableRAMBelow(0x400000, RangeRAM) = %#x, want %#x", got, want)
+	}
+}
+
+func TestMemoryMapFromSystem(t *testing.T) {
+	defer func(sysfs, iomem, memblock string) {
+		memoryMapRoot, procIOMem, memblockRoot = sysfs, iomem, memblock
+	}(memoryMapRoot, procIOMem, memblockRoot)
+
+	for _, tt := range []struct {
+		name     string
+		iomem    string
+		memblock string
+		want     MemoryMap
+		wantErr  error
+	}{
+		{
+			name:  "iomem",
+			iomem: "00000000-00000fff : Reserved\n00001000-0009ffff : System RAM\n",
+			want: MemoryMap{
+				TypedRange{Range: Range{Start: 0, Size: 0x1000}, Type: RangeReserved},
+				TypedRange{Range: Range{Start: 0x1000, Size: 0x9f000}, Type: RangeRAM},
+			},
+		},
+		{
+			// Placement relies on this map, so nested reservations
+			// are carved out.
+			name:  "iomem with children",
+			iomem: "00001000-0009ffff : System RAM\n  00002000-00002fff : reserved\n",
+			want: MemoryMap{
+				TypedRange{Range: Range{Start: 0x1000, Size: 0x1000}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0x2000, Size: 0x1000}, Type: RangeReserved},
+				TypedRange{Range: Range{Start: 0x3000, Size: 0x9d000}, Type: RangeRAM},
+			},
+		},
+		{
+			name:     "iomem hidden from non-root",
+			iomem:    "00000000-00000000 : Reserved\n00000000-00000000 : System RAM\n",
+			memblock: "0: 0x0000000000000000..0x000000000009ffff\n",
+			want: MemoryMap{
+				TypedRange{Range: Range{Start: 0, Size: 0xa0000}, Type: RangeRAM},
+			},
+		},
+		{
+			name:    "no source",
+			wantErr: ErrSourceUnavailable,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			d := t.TempDir()
+			memoryMapRoot = path.Join(d, "memmap")
+			procIOMem = path.Join(d, "iomem")
+			memblockRoot = path.Join(d, "memblock")
+			if tt.iomem != "" {
+				if err := os.WriteFile(procIOMem, []byte(tt.iomem), 0o666); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.memblock != "" {
+				if err := os.Mkdir(memblockRoot, 0o777); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path.Join(memblockRoot, "memory"), []byte(tt.memblock), 0o666); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path.Join(memblockRoot, "reserved"), nil, 0o666); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			mm, err := MemoryMapFromSystem()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("MemoryMapFromSystem() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(mm, tt.want) {
+				t.Errorf("MemoryMapFromSystem() = %v, want %v", mm, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryMapGaps(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		mm   MemoryMap
+		want Ranges
+	}{
+		{name: "empty"},
+		{
+			name: "single range",
+			mm: MemoryMap{
+				TypedRange{Range: Range{Start: 0x1000, Size: 0x1000}, Type: RangeRAM},
+			},
+		},
+		{
+			name: "contiguous",
+			mm: MemoryMap{
+				TypedRange{Range: Range{Start: 0, Size: 0x1000}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0x1000, Size: 0x1000}, Type: RangeReserved},
+			},
+		},
+		{
+			name: "holes",
+			mm: MemoryMap{
+				TypedRange{Range: Range{Start: 0, Size: 0x9f000}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0x9f000, Size: 0x1000}, Type: RangeReserved},
+				TypedRange{Range: Range{Start: 0x100000, Size: 0x1000}, Type: RangeACPI},
+				TypedRange{Range: Range{Start: 0x200000, Size: 0x100000}, Type: RangeRAM},
+			},
+			want: Ranges{
+				Range{Start: 0xa0000, Size: 0x60000},
+				Range{Start: 0x101000, Size: 0xff000},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.mm.Gaps(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Gaps() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryMapCoverGaps(t *testing.T) {
+	mm := MemoryMap{
+		TypedRange{Range: Range{Start: 0x1000, Size: 0x9e000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x9f000, Size: 0x1000}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 0x100000, Size: 0x1000}, Type: RangeACPI},
+		TypedRange{Range: Range{Start: 0x200000, Size: 0x100000}, Type: RangeRAM},
+	}
+	orig := mm.Clone()
+
+	got := mm.CoverGaps(RangeReserved)
+	want := MemoryMap{
+		TypedRange{Range: Range{Start: 0, Size: 0x1000}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 0x1000, Size: 0x9e000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x9f000, Size: 0x1000}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 0xa0000, Size: 0x60000}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 0x100000, Size: 0x1000}, Type: RangeACPI},
+		TypedRange{Range: Range{Start: 0x101000, Size: 0xff000}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 0x200000, Size: 0x100000}, Type: RangeRAM},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CoverGaps(%v) =\n%v, want\n%v", RangeReserved, got, want)
+	}
+	if gaps := got.Gaps(); gaps != nil {
+		t.Errorf("CoverGaps(%v).Gaps() = %v, want none", RangeReserved, gaps)
+	}
+	if !reflect.DeepEqual(mm, orig) {
+		t.Errorf("CoverGaps modified the map: got %v, want %v", mm, orig)
+	}
+	if got := MemoryMap(nil).CoverGaps(RangeReserved); got != nil {
+		t.Errorf("CoverGaps of an empty map = %v, want nil", got)
+	}
+}
+
+func TestMemoryMapString(t *testing.T) {
+	mm := MemoryMap{
+		TypedRange{Range: Range{Start: 0x100000, Size: 0x7ff00000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0, Size: 0x9fc00}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x9fc00, Size: 0x400}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 0x80000000, Size: 0x10000}, Type: RangeNVS},
+	}
+	want := `0x0000000000000000  0x000000000009fc00  639 KiB  System RAM
+0x000000000009fc00  0x00000000000a0000  1.0 KiB  Reserved
+0x0000000000100000  0x0000000080000000  2.0 GiB  System RAM
+0x0000000080000000  0x0000000080010000  64 KiB   ACPI Non-volatile Storage
+`
+	if got := mm.String(); got != want {
+		t.Errorf("String() =\n%s\nwant\n%s", got, want)
+	}
+	if got := MemoryMap(nil).String(); got != "" {
+		t.Errorf("String() of an empty map = %q, want \"\"", got)
+	}
+}
+
+func TestAllocatorsUseUsableTypes(t *testing.T) {
+	mm := MemoryMap{
+		TypedRange{Range: Range{Start: 0, Size: 0x100000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x100000, Size: 0x100000}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 0x200000, Size: 0x100000}, Type: RangeDefault},
+	}
+
+	for _, tt := range []struct {
+		name      string
+		types     []RangeType
+		wantTop   uintptr
+		wantAvail uintptr
+	}{
+		// Memory only places segments in RangeRAM unless told otherwise.
+		{name: "default", wantTop: 0x2ff000, wantAvail: 0x100000},
+		{name: "Default is usable", types: []RangeType{RangeRAM, RangeDefault}, wantTop: 0x2ff000, wantAvail: 0x300000},
+		{name: "RAM only", types: []RangeType{RangeRAM}, wantTop: 0xff000, wantAvail: 0x100000},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := mm.FindSpaceTopDown(0x1000, 0x1000, tt.types...); err != nil || got != tt.wantTop {
+				t.Errorf("FindSpaceTopDown() = %#x, %v, want %#x", got, err, tt.wantTop)
+			}
+			if got, err := mm.FindCrashKernelRegion(0x100000, 0x100000, 0, tt.types...); err != nil || got.Start != 0 {
+				t.Errorf("FindCrashKernelRegion() = %v, %v, want start 0", got, err)
+			}
+			rs := mm.AvailableRAMWithGuard(0x1000, tt.types...)
+			if last := rs[len(rs)-1]; last.End() != tt.wantTop {
+				t.Errorf("AvailableRAMWithGuard() = %v, want last range to end at %#x", rs, tt.wantTop)
+			}
+			avail := Memory{Phys: mm, UsableTypes: tt.types}.AvailableRAM()
+			if last := avail[len(avail)-1]; last.End() != tt.wantAvail {
+				t.Errorf("AvailableRAM() = %v, want last range to end at %#x", avail, tt.wantAvail)
+			}
+		})
+	}
+}
+
+func TestMemoryMapCheckInvariants(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		mm      MemoryMap
+		wantErr bool
+	}{
+		{
+			name: "empty map",
+		},
+		{
+			name: "valid",
+			mm: MemoryMap{
+				TypedRange{Range: Range{Start: 0, Size: 0x1000}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0x1000, Size: 0x1000}, Type: RangeReserved},
+				TypedRange{Range: Range{Start: 0x3000, Size: 0x1000}, Type: RangeRAM},
+			},
+		},
+		{
+			name: "empty range",
+			mm: MemoryMap{
+				TypedRange{Range: Range{Start: 0, Size: 0x1000}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0x2000, Size: 0}, Type: RangeRAM},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unsorted",
+			mm: MemoryMap{
+				TypedRange{Range: Range{Start: 0x2000, Size: 0x1000}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0, Size: 0x1000}, Type: RangeRAM},
+			},
+			wantErr: true,
+		},
+		{
+			name: "overlapping",
+			mm: MemoryMap{
+				TypedRange{Range: Range{Start: 0, Size: 0x2000}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0x1000, Size: 0x1000}, Type: RangeReserved},
+			},
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.mm.checkInvariants(); (err != nil) != tt.wantErr {
+				t.Errorf("checkInvariants() = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMemoryMapValidate(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		mm      MemoryMap
+		wantErr string
+	}{
+		{
+			name: "valid",
+			mm: MemoryMap{
+				TypedRange{Range: Range{Start: 0x1000, Size: 0x1000}, Type: RangeReserved},
+				TypedRange{Range: Range{Start: 0, Size: 0x1000}, Type: RangeRAM},
+			},
+		},
+		{
+			name: "empty range",
+			mm: MemoryMap{
+				TypedRange{Range: Range{Start: 0x2000, Size: 0}, Type: RangeRAM},
+			},
+			wantErr: "invalid memory map: range {addr: [0x2000, 0x2000), type: System RAM} is empty",
+		},
+		{
+			name: "wraps",
+			mm: MemoryMap{
+				TypedRange{Range: Range{Start: MaxAddr, Size: 0x1000}, Type: RangeRAM},
+			},
+			wantErr: "wraps around the address space",
+		},
+		{
+			name: "overlapping after sorting",
+			mm: MemoryMap{
+				TypedRange{Range: Range{Start: 0x1000, Size: 0x1000}, Type: RangeReserved},
+				TypedRange{Range: Range{Start: 0x4000, Size: 0x1000}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0, Size: 0x2000}, Type: RangeRAM},
+			},
+			wantErr: "overlaps",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.mm.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsEmptyInclusiveRange(t *testing.T) {
+	for _, tt := range []struct {
+		start, end uintptr
+		want       bool
+	}{
+		// /proc/iomem prints unset resources as 00000000-00000000.
+		{start: 0, end: 0, want: true},
+		{start: 0x1000, end: 0x1000, want: true},
+		{start: 0x1000, end: 0x1001, want: false},
+		{start: 0, end: 0xfff, want: false},
+	} {
+		if got := isEmptyInclusiveRange(tt.start, tt.end); got != tt.want {
+			t.Errorf("isEmptyInclusiveRange(%#x, %#x) = %t, want %t", tt.start, tt.end, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryMapIntersections(t *testing.T) {
+	mm := MemoryMap{
+		TypedRange{Range: Range{Start: 0, Size: 0x10000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x10000, Size: 0x1000}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 0x20000, Size: 0x10000}, Type: RangeRAM},
+	}
+	for _, tt := range []struct {
+		r    Range
+		want []TypedRange
+	}{
+		{
+			r: Range{Start: 0x1000, Size: 0x10000},
+			want: []TypedRange{
+				{Range: Range{Start: 0x1000, Size: 0xf000}, Type: RangeRAM},
+				{Range: Range{Start: 0x10000, Size: 0x1000}, Type: RangeReserved},
+			},
+		},
+		{
+			r:    Range{Start: 0x11000, Size: 0xf000},
+			want: nil,
+		},
+		{
+			r:    Range{Start: 0x0, Size: 0x100000},
+			want: []TypedRange(mm),
+		},
+		{
+			r:    Range{Start: 0x1000, Size: 0},
+			want: nil,
+		},
+	} {
+		if got := mm.Intersections(tt.r); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Intersections(%v) = %v, want %v", tt.r, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryMapForEachIn(t *testing.T) {
+	mm := MemoryMap{
+		TypedRange{Range: Range{Start: 0, Size: 0x10000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x10000, Size: 0x1000}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 0x20000, Size: 0x10000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x40000, Size: 0x10000}, Type: RangeACPI},
+	}
+	errStop := errors.New("stop")
+
+	for _, tt := range []struct {
+		name    string
+		window  Range
+		stopAt  int
+		want    []TypedRange
+		wantErr error
+	}{
+		{
+			name:   "clipped",
+			window: Range{Start: 0x8000, Size: 0x20000},
+			want: []TypedRange{
+				{Range: Range{Start: 0x8000, Size: 0x8000}, Type: RangeRAM},
+				{Range: Range{Start: 0x10000, Size: 0x1000}, Type: RangeReserved},
+				{Range: Range{Start: 0x20000, Size: 0x8000}, Type: RangeRAM},
+			},
+		},
+		{
+			name:   "hole",
+			window: Range{Start: 0x30000, Size: 0x10000},
+		},
+		{
+			name:   "last",
+			window: Range{Start: 0x48000, Size: 0x100000},
+			want: []TypedRange{
+				{Range: Range{Start: 0x48000, Size: 0x8000}, Type: RangeACPI},
+			},
+		},
+		{
+			name:    "stop early",
+			window:  Range{Start: 0, Size: 0x100000},
+			stopAt:  2,
+			want:    []TypedRange(mm[:2]),
+			wantErr: errStop,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []TypedRange
+			err := mm.ForEachIn(tt.window, func(tr TypedRange) error {
+				got = append(got, tr)
+				if len(got) == tt.stopAt {
+					return errStop
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ForEachIn(%v) = %v, want %v", tt.window, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ForEachIn(%v) visited %v, want %v", tt.window, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAvailableRAMWithGuard(t *testing.T) {
+	mm := MemoryMap{
+		TypedRange{Range: Range{Start: 0, Size: 0x3000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x3000, Size: 0x1000}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 0x4000, Size: 0x2000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x6000, Size: 0x1000}, Type: RangeACPI},
+		TypedRange{Range: Range{Start: 0x7000, Size: 0x2001}, Type: RangeRAM},
+	}
+	for _, tt := range []struct {
+		guard uint
+		want  Ranges
+	}{
+		{
+			guard: 0,
+			want:  mm.RAM(),
+		},
+		{
+			guard: 0x1000,
+			want: Ranges{
+				Range{Start: 0x1000, Size: 0x1000},
+				Range{Start: 0x8000, Size: 0x1},
+			},
+		},
+		{
+			guard: 0x1800,
+			want:  nil,
+		},
+	} {
+		if got := mm.AvailableRAMWithGuard(tt.guard); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("AvailableRAMWithGuard(%#x) = %v, want %v", tt.guard, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryMapInsert(t *testing.T) {
+	for i, tt := range []struct {
+		mm   MemoryMap
+		r    TypedRange
+		want MemoryMap
+	}{
+		{
+			// r is entirely within m's one range.
+			mm: MemoryMap{
+				TypedRange{Range: Range{Start: 0, Size: 0x2000}, Type: RangeRAM},
+			},
+			r: TypedRange{Range: Range{Start: 0x100, Size: 0x100}, Type: RangeReserved},
+			want: MemoryMap{
+				TypedRange{Range: Range{Start: 0, Size: 0x100}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0x100, Size: 0x100}, Type: RangeReserved},
+				TypedRange{Range: Range{Start: 0x200, Size: 0x2000 - 0x200}, Type: RangeRAM},
+			},
+		},
+		{
+			// r sits across three RAM ranges.
+			mm: MemoryMap{
+				TypedRange{Range: Range{Start: 0, Size: 0x150}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0x150, Size: 0x50}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0x1a0, Size: 0x100}, Type: RangeRAM},
+			},
+			r: TypedRange{Range: Range{Start: 0x100, Size: 0x100}, Type: RangeReserved},
+			want: MemoryMap{
+				TypedRange{Range: Range{Start: 0, Size: 0x100}, Type: RangeRAM},
+				TypedRange{Range: Range{Start: 0x100, Size: 0x100}, Type: RangeReserved},
+				TypedRange{Range: Range{Start: 0x200, Size: 0xa0}, Type: RangeRAM},
+			},
+		},
+		{
+			// r is a superset of the ranges in m.
+			mm: MemoryMap{
+				TypedRange{Range: Range{Start: 0x100, Size: 0x50}, Type: RangeRAM},
+			},
+			r: TypedRange{Range: Range{Start: 0x100, Size: 0x100}, Type: RangeReserved},
+			want: MemoryMap{
+				TypedRange{Range: Range{Start: 0x100, Size: 0x100}, Type: RangeReserved},
+			},
+		},
+		{
+			// r is the first range in the map.
+			mm: MemoryMap{},
+			r:  TypedRange{Range: Range{Start: 0x100, Size: 0x100}, Type: RangeReserved},
+			want: MemoryMap{
+				TypedRange{Range: Range{Start: 0x100, Size: 0x100}, Type: RangeReserved},
+			},
+		},
+	} {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			// Make a copy for the Errorf print.
+			mm := tt.mm
+			tt.mm.Insert(tt.r)
+
+			if !reflect.DeepEqual(tt.mm, tt.want) {
+				t.Errorf("\n%v.Insert(%s) =\n%v, want\n%v", mm, tt.r, tt.mm, tt.want)
+			}
+		})
+	}
+}
+
+// insertReference inserts r the way Insert does for maps that are unsorted or
+// have overlaps, rebuilding and sorting the whole map. Insert must produce the
+// same maps.
+func insertReference(mm MemoryMap, r TypedRange) MemoryMap {
+	mm = mm.Clone()
+	mm.insertSlow(r)
+	return mm
+}
+
+var insertTestTypes = []RangeType{RangeRAM, RangeReserved, RangeACPI, RangeNVS}
+
+// randomMemoryMap returns a sorted map of n non-empty ranges, some adjacent
+// and some with holes in between.
+func randomMemoryMap(rnd *rand.Rand, n int) MemoryMap {
+	var mm MemoryMap
+	var start uintptr
+	for i := 0; i < n; i++ {
+		start += uintptr(rnd.Intn(3)) * 0x1000
+		size := uint(1+rnd.Intn(16)) * 0x1000
+		mm = append(mm, TypedRange{
+			Range: Range{Start: start, Size: size},
+			Type:  insertTestTypes[rnd.Intn(len(insertTestTypes))],
+		})
+		start += uintptr(size)
+	}
+	return mm
+}
+
+func TestMemoryMapInsertMatchesReference(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		mm := randomMemoryMap(rnd, rnd.Intn(20))
+		end := uintptr(0x1000)
+		if len(mm) > 0 {
+			end = mm[len(mm)-1].End()
+		}
+		// Sizes are not page multiples, to also cut ranges in odd places.
+		r := TypedRange{
+			Range: Range{Start: uintptr(rnd.Int63n(int64(end) + 0x2000)), Size: uint(1 + rnd.Intn(0x10000))},
+			Type:  insertTestTypes[rnd.Intn(len(insertTestTypes))],
+		}
+
+		want := insertReference(mm, r)
+		got := mm.Clone()
+		got.Insert(r)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%v.Insert(%v) =\n%v, want\n%v", mm, r, got, want)
+		}
+	}
+}
+
+func benchmarkInsert(b *testing.B, insert func(MemoryMap, TypedRange) MemoryMap) {
+	rnd := rand.New(rand.NewSource(1))
+	mm := randomMemoryMap(rnd, 5000)
+	end := mm[len(mm)-1].End()
+	rs := make([]TypedRange, 1000)
+	for i := range rs {
+		rs[i] = TypedRange{
+			Range: Range{Start: uintptr(rnd.Int63n(int64(end))), Size: 0x800},
+			Type:  RangeReserved,
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// The map grows by up to two ranges per Insert; start over
+		// now and then to keep it at about 5000 entries.
+		if i%len(rs) == 0 {
+			b.StopTimer()
+			mm = randomMemoryMap(rand.New(rand.NewSource(1)), 5000)
+			b.StartTimer()
+		}
+		mm = insert(mm, rs[i%len(rs)])
+	}
+}
+
+func BenchmarkMemoryMapInsert(b *testing.B) {
+	benchmarkInsert(b, func(mm MemoryMap, r TypedRange) MemoryMap {
+		mm.Insert(r)
+		return mm
+	})
+}
+
+func BenchmarkMemoryMapInsertReference(b *testing.B) {
+	benchmarkInsert(b, insertReference)
+}
+
+func TestMemoryMapInsertUnsortedOverlapping(t *testing.T) {
+	// As e.g. a hand-assembled map or a buggy firmware table may be.
+	mm := MemoryMap{
+		TypedRange{Range: Range{Start: 0x3000, Size: 0x1000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0, Size: 0x2000}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x1000, Size: 0x2000}, Type: RangeACPI},
+	}
+	mm.InsertType(0x1800, 0x2000, RangeReserved)
+
+	want := MemoryMap{
+		TypedRange{Range: Range{Start: 0, Size: 0x1800}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x1000, Size: 0x800}, Type: RangeACPI},
+		TypedRange{Range: Range{Start: 0x1800, Size: 0x2000}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 0x3800, Size: 0x800}, Type: RangeRAM},
+	}
+	if !reflect.DeepEqual(mm, want) {
+		t.Errorf("InsertType(0x1800, 0x2000, %v) =\n%v, want\n%v", RangeReserved, mm, want)
+	}
+}
+
+func TestMemoryMapInsertType(t *testing.T) {
+	mm := MemoryMap{
+		TypedRange{Range: Range{Start: 0, Size: 0x2000}, Type: RangeRAM},
+	}
+	mm.InsertType(0x100, 0x100, RangeReserved)
+
+	want := MemoryMap{
+		TypedRange{Range: Range{Start: 0, Size: 0x100}, Type: RangeRAM},
+		TypedRange{Range: Range{Start: 0x100, Size: 0x100}, Type: RangeReserved},
+		TypedRange{Range: Range{Start: 0x200, Size: 0x2000 - 0x200}, Type: RangeRAM},
+	}
+	if !reflect.DeepEqual(mm, want) {
+		t.Errorf("InsertType(0x100, 0x100, %v) = %v, want %v", RangeReserved, mm, want)
+	}
+}
+
+func TestMemoryMapFromIOMem(t *testing.T) {
+	f := `10000000-101fffff : reserved
+10201000-10202fff : reserved
+14000000-1effffff : System RAM
+  14154000-14154fff : reserved
+  141c0000-14bcffff : reserved
+  14c10000-1636ffff : Kernel code
+  16370000-1686ffff : reserved
+  16870000-1734ffff : Kernel data
+  17350000-17377fff : reserved`
+	mm, err := memoryMapFromIOMem(strings.NewReader(f), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := MemoryMap{
+		TypedRange{Range: RangeFromInterval(0x10000000, 0x101fffff+1), Type: RangeReserved},
+		TypedRange{Range: RangeFromInterval(0x10201000, 0x10202fff+1), Type: RangeReserved},
+		TypedRange{Range: RangeFromInterval(0x14000000, 0x1effffff+1), Type: RangeRAM},
+	}
+	if !reflect.DeepEqual(mm, want) {
+		t.Errorf("top-level ranges: got %v, want %v", mm, want)
+	}
+	// The kernel's own reservations are not carved out of System RAM.
+	kernelCode := RangeFromInterval(0x14c10000, 0x1636ffff+1)
+	if !mm.IsRAM(kernelCode) {
+		t.Errorf("IsRAM(Kernel code) = false for top-level ranges, want true")
+	}
+
+	mm, err = MemoryMapFromIOMemWithChildren(strings.NewReader(f))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = MemoryMap{
+		TypedRange{Range: RangeFromInterval(0x10000000, 0x101fffff+1), Type: RangeReserved},
+		TypedRange{Range: RangeFromInterval(0x10201000, 0x10202fff+1), Type: RangeReserved},
+		TypedRange{Range: RangeFromInterval(0x14000000, 0x14154000), Type: RangeRAM},
+		TypedRange{Range: RangeFromInterval(0x14154000, 0x14154fff+1), Type: RangeReserved},
+		TypedRange{Range: RangeFromInterval(0x14155000, 0x141c0000), Type: RangeRAM},
+		TypedRange{Range: RangeFromInterval(0x141c0000, 0x14bcffff+1), Type: RangeReserved},
+		TypedRange{Range: RangeFromInterval(0x14bd0000, 0x14c10000), Type: RangeRAM},
+		TypedRange{Range: RangeFromInterval(0x14c10000, 0x1636ffff+1), Type: RangeType("Kernel code")},
+		TypedRange{Range: RangeFromInterval(0x16370000, 0x1686ffff+1), Type: RangeReserved},
+		TypedRange{Range: RangeFromInterval(0x16870000, 0x1734ffff+1), Type: RangeType("Kernel data")},
+		TypedRange{Range: RangeFromInterval(0x17350000, 0x17377fff+1), Type: RangeReserved},
+		TypedRange{Range: RangeFromInterval(0x17378000, 0x1effffff+1), Type: RangeRAM},
+	}
+	if !reflect.DeepEqual(mm, want) {
+		t.Errorf("Not equal, got %v", mm)
+	}
+	if mm.IsRAM(kernelCode) {
+		t.Errorf("IsRAM(Kernel code) = true with children, want false")
+	}
+
+	ignored := `00000000-00000000 : reserved
+10000000-101fffff
+10201000 : reserved
+: System RAM
+  141GGGGG-14154fff : reserved
+  141c0000-14GGGGGG : reserved`
+	mm2, err := MemoryMapFromIOMemWithChildren(strings.NewReader(ignored))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := MemoryMap(nil); !reflect.DeepEqual(mm2, want) {
+		t.Errorf("Memory maps not equal, got %v, want %v", mm2, want)
+	}
+}
+
+func TestMemoryMapFromIOMemPersistent(t *testing.T) {
+	f := `00100000-7fffffff : System RAM
+100000000-17fffffff : Persistent Memory
+180000000-1bfffffff : Persistent Memory (legacy)`
+	mm, err := memoryMapFromIOMem(strings.NewReader(f), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := MemoryMap{
+		TypedRange{Range: RangeFromInterval(0x100000, 0x80000000), Type: RangeRAM},
+		TypedRange{Range: RangeFromInterval(0x100000000, 0x180000000), Type: RangePersistent},
+		TypedRange{Range: RangeFromInterval(0x180000000, 0x1c0000000), Type: RangePersistentLegacy},
+	}
+	if !reflect.DeepEqual(mm, want) {
+		t.Fatalf("memoryMapFromIOMem() = %v, want %v", mm, want)
+	}
+
+	wantUEFI := UEFIPayloadMemoryMap{
+		{Start: 0x100000, End: 0x7fffffff, Type: UEFIPayloadTypeRAM},
+		{Start: 0x100000000, End: 0x17fffffff, Type: UEFIPayloadTypeReserved},
+		{Start: 0x180000000, End: 0x1bfffffff, Type: UEFIPayloadTypeReserved},
+	}
+	if got := mm.ToUEFIPayloadMemoryMap(); !reflect.DeepEqual(got, wantUEFI) {
+		t.Errorf("ToUEFIPayloadMemoryMap() = %v, want %v", got, wantUEFI)
+	}
+}
+
+func TestMemoryMapFromMemblock(t *testing.T) {
+	memory := `  0: 0x0000004000000000..0x00000040113fffff
+   1: 0x0000004011400000..0x00000040123fffff
+   2: 0x0000004012400000..0x00000040dfffffff
+   3: 0x0000004400000000..0x00000044dfffffff`
+	reserved := `  0: 0x0000004000000000..0x00000040113fffff
+   1: 0x0000004012400000..0x00000040125fffff
+   2: 0x0000004012800000..0x00000040137fffff`
+	mm, err := memoryMapFromMemblock(strings.NewReader(memory), strings.NewReader(reserved))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := MemoryMap{
+		TypedRange{Range: RangeFromInterval(0x4000000000, 0x4011400000), Type: RangeReserved},
+		TypedRange{Range: RangeFromInterval(0x4011400000, 0x4012400000), Type: RangeRAM},
+		TypedRange{Range: RangeFromInterval(0x4012400000, 0x4012600000), Type: RangeReserved},
+		TypedRange{Range: RangeFromInterval(0x4012600000, 0x4012800000), Type: RangeRAM},
+		TypedRange{Range: RangeFromInterval(0x4012800000, 0x4013800000), Type: RangeReserved},
+		TypedRange{Range: RangeFromInterval(0x4013800000, 0x40e0000000), Type: RangeRAM},
+		TypedRange{Range: RangeFromInterval(0x4400000000, 0x44e0000000), Type: RangeRAM},
+	}
+	if !reflect.DeepEqual(mm, want) {
+		t.Errorf("Not equal, got %v", mm)
 	}
 
 	memIgnored := `  0: 0x0000000000000000..0x0000000000000000
@@ -434,6 +1712,109 @@ func TestMemoryMapFromMemblock(t *testing.T) {
 	}
 }
 
+func TestMemoryMapFromMemblockReservedOutsideMemory(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	memory := `  0: 0x0000004000000000..0x00000040113fffff`
+	for _, tt := range []struct {
+		reserved string
+		wantLog  bool
+	}{
+		{reserved: `  0: 0x0000004000000000..0x00000040000fffff`, wantLog: false},
+		{reserved: `  0: 0x0000000040000000..0x00000000400fffff`, wantLog: true},
+	} {
+		buf.Reset()
+		if _, err := memoryMapFromMemblock(strings.NewReader(memory), strings.NewReader(tt.reserved)); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Contains(buf.String(), "outside of all memory ranges"); got != tt.wantLog {
+			t.Errorf("reserved %q: logged %q, want warning %t", tt.reserved, buf.String(), tt.wantLog)
+		}
+	}
+}
+
+func TestParseIOMemLine(t *testing.T) {
+	for _, tt := range []struct {
+		line string
+		want *TypedRange
+	}{
+		{
+			line: "10000000-101fffff : reserved",
+			want: &TypedRange{Range: RangeFromInterval(0x10000000, 0x10200000), Type: RangeReserved},
+		},
+		{
+			line: "740100000000-7401001fffff : PCI Bus 0001:01",
+			want: &TypedRange{Range: RangeFromInterval(0x740100000000, 0x740100200000), Type: RangeType("PCI Bus 0001:01")},
+		},
+		{
+			line: "  fe000000-fe0fffff : 0000:00:02.0",
+			want: &TypedRange{Range: RangeFromInterval(0xfe000000, 0xfe100000), Type: RangeType("0000:00:02.0")},
+		},
+		{line: "10201000 : reserved"},
+		{line: "10000000-101fffff"},
+	} {
+		tr, ok := ParseIOMemLine(tt.line)
+		if ok != (tt.want != nil) || !reflect.DeepEqual(tr, tt.want) {
+			t.Errorf("ParseIOMemLine(%q) = %v, %t, want %v", tt.line, tr, ok, tt.want)
+		}
+	}
+}
+
+func FuzzParseIOMemLine(f *testing.F) {
+	for _, seed := range []string{
+		"10000000-101fffff : reserved",
+		"  14154000-14154fff : reserved",
+		"740100000000-7401001fffff : PCI Bus 0001:01",
+		"00000000-00000000 : reserved",
+		"ffffffffffffffff-0 : reserved",
+		"10000000-1ffffffffffffffff : System RAM",
+		"0-ffffffffffffffff : System RAM",
+		"10201000 : reserved",
+		": System RAM",
+		"-:",
+		"",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, line string) {
+		tr, ok := ParseIOMemLine(line)
+		if ok != (tr != nil) {
+			t.Fatalf("ParseIOMemLine(%q) = %v, %t: ok must match a non-nil range", line, tr, ok)
+		}
+		if ok && (tr.Size == 0 || tr.Last() < tr.Start) {
+			t.Errorf("ParseIOMemLine(%q) = %v, want a non-empty range", line, tr)
+		}
+	})
+}
+
+func FuzzParseMemblockLine(f *testing.F) {
+	for _, seed := range []string{
+		"  0: 0x0000004000000000..0x00000040113fffff",
+		"   3: 0x0000004400000000..0x00000044dfffffff",
+		"  0: 0x0000000000000000..0x0000000000000000",
+		"  0: 0xffffffffffffffff..0x0",
+		"  0: 0x0..0xffffffffffffffff",
+		"  0: 0x0000004000000000..",
+		"   3: 0x00000044000000000x00000044dfffffff",
+		"0x0000004012400000..0x00000040dfffffff",
+		":..",
+		"",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, line string) {
+		r, ok := ParseMemblockLine(line)
+		if ok != (r != nil) {
+			t.Fatalf("ParseMemblockLine(%q) = %v, %t: ok must match a non-nil range", line, r, ok)
+		}
+		if ok && (r.Size == 0 || r.Last() < r.Start) {
+			t.Errorf("ParseMemblockLine(%q) = %v, want a non-empty range", line, r)
+		}
+	})
+}
+
 func TestMemoryMapMerge(t *testing.T) {
 	mm := MemoryMap{
 		TypedRange{Range: Range{Start: 0, Size: 50}, Type: RangeRAM},
@@ -456,7 +1837,7 @@ func TestMemoryMapMerge(t *testing.T) {
 		TypedRange{Range: Range{Start: 600, Size: 50}, Type: RangeReserved},
 	}
 
-	mm.mergeAdjacent()
+	mm.Merge()
 	if !reflect.DeepEqual(mm, want) {
 		t.Errorf("Merge() got %v, want %v", mm, want)
 	}
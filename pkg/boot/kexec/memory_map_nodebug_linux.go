@@ -0,0 +1,11 @@
+// Copyright 2026 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !kexecdebug
+
+package kexec
+
+// checkMemoryMapInvariants is off in normal builds; see
+// memory_map_debug_linux.go.
+const checkMemoryMapInvariants = false
@@ -10,9 +10,7 @@
 package multiboot
 
 import (
-	"bytes"
 	"debug/elf"
-	"encoding/binary"
 	"fmt"
 	"io"
 	"log"
@@ -69,17 +67,10 @@ type multiboot struct {
 	loadedModules modules
 }
 
-var rangeTypes = map[kexec.RangeType]uint32{
-	kexec.RangeRAM:      1,
-	kexec.RangeDefault:  2,
-	kexec.RangeACPI:     3,
-	kexec.RangeNVS:      4,
-	kexec.RangeReserved: 2,
-}
-
-var sizeofMemoryMap = uint(binary.Size(MemoryMap{}))
-
 // MemoryMap represents a reserved range of memory passed via the multiboot Info header.
+//
+// It describes an entry of the kexec.MultibootMmap passed to the kernel, for
+// debugging and for esxBootInfo.
 type MemoryMap struct {
 	// Size is the size of the associated structure in bytes.
 	Size uint32
@@ -98,15 +89,6 @@ func (m MemoryMap) String() string {
 
 type memoryMaps []MemoryMap
 
-// marshal writes out the exact bytes expected by the multiboot info header
-// specified in
-// https://www.gnu.org/software/grub/manual/multiboot/multiboot.html#Boot-information-format.
-func (m memoryMaps) marshal() ([]byte, error) {
-	buf := bytes.Buffer{}
-	err := binary.Write(&buf, binary.NativeEndian, m)
-	return buf.Bytes(), err
-}
-
 // elems adds esxBootInfo info elements describing the memory map of the system.
 func (m memoryMaps) elems() []elem {
 	var e []elem
@@ -419,19 +401,13 @@ func (*esxBootInfoHeader) addInfo(m *multiboot) (addr uintptr, err error) {
 
 func (m multiboot) memoryMap() memoryMaps {
 	var ret memoryMaps
-	for _, r := range m.mem.Phys {
-		typ, ok := rangeTypes[r.Type]
-		if !ok {
-			typ = rangeTypes[kexec.RangeDefault]
-		}
-		v := MemoryMap{
-			// Size is really used for skipping to the next pair.
-			Size:     uint32(sizeofMemoryMap) - 4,
-			BaseAddr: uint64(r.Start),
-			Length:   uint64(r.Size),
-			Type:     typ,
-		}
-		ret = append(ret, v)
+	for _, e := range m.mem.Phys.ToMultibootMmap() {
+		ret = append(ret, MemoryMap{
+			Size:     e.Size,
+			BaseAddr: e.BaseAddr,
+			Length:   e.Length,
+			Type:     uint32(e.Type),
+		})
 	}
 	log.Printf("Memory map: %v", ret)
 	return ret
@@ -439,8 +415,7 @@ func (m multiboot) memoryMap() memoryMaps {
 
 // addMmap adds a multiboot-marshaled memory map in memory.
 func (m *multiboot) addMmap() (addr uintptr, size uint, err error) {
-	mmap := m.memoryMap()
-	d, err := mmap.marshal()
+	d, err := m.mem.Phys.ToMultibootMmap().Marshal()
 	if err != nil {
 		return 0, 0, err
 	}
@@ -448,7 +423,7 @@ func (m *multiboot) addMmap() (addr uintptr, size uint, err error) {
 	if err != nil {
 		return 0, 0, err
 	}
-	return r.Start, uint(len(mmap)) * sizeofMemoryMap, nil
+	return r.Start, uint(len(d)), nil
 }
 
 func (m multiboot) memoryBoundaries() (lower, upper uint32) {
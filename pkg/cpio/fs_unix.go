@@ -286,6 +286,7 @@ func LSInfoFromRecord(rec Record) ls.FileInfo {
 		Name:          rec.Name,
 		Mode:          mode,
 		Rdev:          unix.Mkdev(uint32(rec.Rmajor), uint32(rec.Rminor)),
+		Nlink:         rec.NLink,
 		UID:           uint32(rec.UID),
 		GID:           uint32(rec.GID),
 		Size:          int64(rec.FileSize),
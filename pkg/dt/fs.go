@@ -0,0 +1,52 @@
+// Copyright 2026 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dt
+
+import (
+	"io/fs"
+	"path"
+)
+
+// ReadFS reconstructs a device tree from its file system representation,
+// e.g. the live tree Linux exposes at /proc/device-tree. Every directory is a
+// node and every regular file a property, whose contents are the raw,
+// big-endian property value.
+//
+// The file system representation has neither a header nor a memory
+// reservation block, so the returned FDT has a zero Header and no
+// ReserveEntries.
+func ReadFS(fsys fs.FS) (*FDT, error) {
+	root, err := readFSNode(fsys, ".", "/")
+	if err != nil {
+		return nil, err
+	}
+	return &FDT{RootNode: root}, nil
+}
+
+func readFSNode(fsys fs.FS, dir, name string) (*Node, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	n := &Node{Name: name}
+	for _, e := range entries {
+		p := path.Join(dir, e.Name())
+		switch {
+		case e.IsDir():
+			c, err := readFSNode(fsys, p, e.Name())
+			if err != nil {
+				return nil, err
+			}
+			n.Children = append(n.Children, c)
+		case e.Type().IsRegular():
+			v, err := fs.ReadFile(fsys, p)
+			if err != nil {
+				return nil, err
+			}
+			n.Properties = append(n.Properties, Property{Name: e.Name(), Value: v})
+		}
+	}
+	return n, nil
+}
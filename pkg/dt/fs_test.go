@@ -0,0 +1,64 @@
+// Copyright 2026 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dt
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestReadFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"#address-cells":              {Data: []byte{0, 0, 0, 2}},
+		"model":                       {Data: []byte("qemu\x00")},
+		"chosen/bootargs":             {Data: []byte("console=ttyAMA0\x00")},
+		"memory@40000000/reg":         {Data: []byte{0, 0, 0, 0, 0x40, 0, 0, 0, 0, 0, 0, 0, 0x80, 0, 0, 0}},
+		"memory@40000000/device_type": {Data: []byte("memory\x00")},
+	}
+	want := &FDT{
+		RootNode: &Node{
+			Name: "/",
+			Properties: []Property{
+				{Name: "#address-cells", Value: []byte{0, 0, 0, 2}},
+				{Name: "model", Value: []byte("qemu\x00")},
+			},
+			Children: []*Node{
+				{
+					Name:       "chosen",
+					Properties: []Property{{Name: "bootargs", Value: []byte("console=ttyAMA0\x00")}},
+				},
+				{
+					Name: "memory@40000000",
+					Properties: []Property{
+						{Name: "device_type", Value: []byte("memory\x00")},
+						{Name: "reg", Value: []byte{0, 0, 0, 0, 0x40, 0, 0, 0, 0, 0, 0, 0, 0x80, 0, 0, 0}},
+					},
+				},
+			},
+		},
+	}
+
+	got, err := ReadFS(fsys)
+	if err != nil {
+		t.Fatalf("ReadFS() = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadFS() = %#v, want %#v", got.RootNode, want.RootNode)
+	}
+
+	n, ok := got.NodeByName("memory@40000000")
+	if !ok {
+		t.Fatal("memory@40000000 not found")
+	}
+	p, _ := n.LookProperty("reg")
+	r, err := p.AsRegion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Region{Start: 0x40000000, Size: 0x80000000}); *r != want {
+		t.Errorf("reg = %#v, want %#v", *r, want)
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright 2026 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ls
+
+import (
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// SecurityContext returns the SELinux security context of the file at path,
+// without following symlinks.
+//
+// It returns "?" if the file has no context, e.g. on systems without SELinux,
+// or if the context cannot be read.
+func SecurityContext(path string) string {
+	buf := make([]byte, 256)
+	for {
+		n, err := unix.Lgetxattr(path, "security.selinux", buf)
+		if err == unix.ERANGE {
+			buf = make([]byte, 2*len(buf))
+			continue
+		}
+		if err != nil || n == 0 {
+			return "?"
+		}
+		// The kernel includes the trailing NUL.
+		return strings.TrimRight(string(buf[:n]), "\x00")
+	}
+}
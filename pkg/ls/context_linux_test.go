@@ -0,0 +1,16 @@
+// Copyright 2026 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ls
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSecurityContextMissing(t *testing.T) {
+	if got := SecurityContext(filepath.Join(t.TempDir(), "nope")); got != "?" {
+		t.Errorf("SecurityContext(nonexistent) = %q, want %q", got, "?")
+	}
+}
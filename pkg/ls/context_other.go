@@ -0,0 +1,13 @@
+// Copyright 2026 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+
+package ls
+
+// SecurityContext returns "?", since security contexts are only supported on
+// Linux.
+func SecurityContext(path string) string {
+	return "?"
+}
@@ -0,0 +1,158 @@
+// Copyright 2026 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ls
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// maxLinks is the number of symlinks resolved in one name before giving up,
+// as Linux does.
+const maxLinks = 40
+
+var errTooManyLinks = errors.New("too many levels of symbolic links")
+
+// dirFS is the file system returned by DirFS.
+type dirFS string
+
+// DirFS returns the file system rooted at the host directory dir, like
+// os.DirFS, but dir is treated as the root for symlinks: absolute targets
+// and .. are resolved inside dir, so nothing outside it is reached. It is a
+// ReadLinkFS on every Go release.
+func DirFS(dir string) ReadLinkFS {
+	return dirFS(dir)
+}
+
+// host returns the host path of the resolved name.
+func (d dirFS) host(name string) string {
+	return filepath.Join(string(d), filepath.FromSlash(name))
+}
+
+// pathError returns err for name, without the host path os puts in it.
+func pathError(op, name string, err error) error {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		err = pe.Err
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// resolve returns name with every symlink in it resolved inside d.
+func (d dirFS) resolve(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	var resolved []string
+	todo := strings.Split(name, "/")
+	links := 0
+	for len(todo) > 0 {
+		c := todo[0]
+		todo = todo[1:]
+		switch c {
+		case "", ".":
+			continue
+		case "..":
+			// The root is its own parent.
+			if len(resolved) > 0 {
+				resolved = resolved[:len(resolved)-1]
+			}
+			continue
+		}
+		p := d.host(path.Join(append(resolved, c)...))
+		fi, err := os.Lstat(p)
+		if err != nil {
+			return "", pathError(op, name, err)
+		}
+		if fi.Mode()&fs.ModeSymlink == 0 {
+			resolved = append(resolved, c)
+			continue
+		}
+		if links++; links > maxLinks {
+			return "", &fs.PathError{Op: op, Path: name, Err: errTooManyLinks}
+		}
+		target, err := os.Readlink(p)
+		if err != nil {
+			return "", pathError(op, name, err)
+		}
+		target = filepath.ToSlash(target)
+		if path.IsAbs(target) {
+			resolved = nil
+		}
+		todo = append(strings.Split(target, "/"), todo...)
+	}
+	return path.Join(append([]string{"."}, resolved...)...), nil
+}
+
+// resolveDir resolves the directory of name inside d, but not its last
+// element.
+func (d dirFS) resolveDir(op, name string) (string, error) {
+	if name == "." {
+		return d.resolve(op, name)
+	}
+	dir, err := d.resolve(op, path.Dir(name))
+	if err != nil {
+		return "", err
+	}
+	return path.Join(dir, path.Base(name)), nil
+}
+
+// Open implements fs.FS.Open.
+func (d dirFS) Open(name string) (fs.File, error) {
+	r, err := d.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(d.host(r))
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	return f, nil
+}
+
+// Stat implements fs.StatFS.Stat.
+func (d dirFS) Stat(name string) (fs.FileInfo, error) {
+	r, err := d.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	// r contains no symlinks, so the host does not follow any.
+	fi, err := os.Lstat(d.host(r))
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	return fi, nil
+}
+
+// Lstat implements ReadLinkFS.Lstat.
+func (d dirFS) Lstat(name string) (fs.FileInfo, error) {
+	r, err := d.resolveDir("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Lstat(d.host(r))
+	if err != nil {
+		return nil, pathError("lstat", name, err)
+	}
+	return fi, nil
+}
+
+// ReadLink implements ReadLinkFS.ReadLink. The target is returned as it is
+// stored, i.e. absolute targets are relative to the root of d.
+func (d dirFS) ReadLink(name string) (string, error) {
+	r, err := d.resolveDir("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	target, err := os.Readlink(d.host(r))
+	if err != nil {
+		return "", pathError("readlink", name, err)
+	}
+	return target, nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2026 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !plan9 && !windows
+
+package ls
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirFS(t *testing.T) {
+	d := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(d, "etc"), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(d, "etc", "passwd"), []byte("root"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{
+		"abs":      "/etc",
+		"rel":      "etc/passwd",
+		"up":       "../../..",
+		"host":     d,
+		"loop":     "loop",
+		"etc/back": "../rel",
+	} {
+		if err := os.Symlink(target, filepath.Join(d, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fsys := DirFS(d)
+
+	for _, tt := range []struct {
+		name    string
+		size    int64
+		wantErr error
+	}{
+		{name: "abs/passwd", size: 4},
+		{name: "rel", size: 4},
+		{name: "up/etc/passwd", size: 4},
+		{name: "etc/back", size: 4},
+		{name: "host", wantErr: fs.ErrNotExist},
+		{name: "loop", wantErr: errTooManyLinks},
+		{name: "../etc", wantErr: fs.ErrInvalid},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fi, err := fs.Stat(fsys, tt.name)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Stat(%q) = %v, want %v", tt.name, err, tt.wantErr)
+			}
+			if err == nil && fi.Size() != tt.size {
+				t.Errorf("Stat(%q).Size() = %d, want %d", tt.name, fi.Size(), tt.size)
+			}
+		})
+	}
+
+	fi, err := fsys.Lstat("abs")
+	if err != nil || fi.Mode()&fs.ModeSymlink == 0 {
+		t.Errorf("Lstat(abs) = %v, %v, want a symlink", fi, err)
+	}
+	if target, err := fsys.ReadLink("up/abs"); err != nil || target != "/etc" {
+		t.Errorf("ReadLink(up/abs) = %q, %v, want /etc", target, err)
+	}
+	if b, err := fs.ReadFile(fsys, "abs/passwd"); err != nil || string(b) != "root" {
+		t.Errorf("ReadFile(abs/passwd) = %q, %v, want root", b, err)
+	}
+}
@@ -5,14 +5,20 @@
 package ls
 
 import (
+	"io/fs"
+	"math"
 	"os"
 	"os/user"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 	"syscall"
 	"testing"
+	"testing/fstest"
 	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 const lsregex string = "^([rwxSTstdcb\\-lp?]{10})\\s+(\\d+)?\\s?(\\S+)\\s+(\\S+)\\s+([0-9,]+)?\\s+(\\d+)?(\\D+)?(\\d{1,2}\\D\\d{1,2}\\D\\d{1,2})?(\\D{4})?([\\D|\\d]*)"
@@ -80,6 +86,50 @@ func TestFileInfoBadSys(t *testing.T) {
 
 }
 
+type linkFS struct {
+	fstest.MapFS
+}
+
+func (linkFS) ReadLink(name string) (string, error) {
+	return "target-of-" + name, nil
+}
+
+func (l linkFS) Lstat(name string) (fs.FileInfo, error) {
+	return fs.Stat(l.MapFS, name)
+}
+
+func TestFromFSFileInfo(t *testing.T) {
+	fsys := fstest.MapFS{"link": &fstest.MapFile{Mode: fs.ModeSymlink}}
+	// ReadDir does not follow symlinks.
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := entries[0].Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		fsys fs.FS
+		want string
+	}{
+		{name: "ReadLinkFS", fsys: linkFS{fsys}, want: "target-of-link"},
+		{name: "plain fs.FS", fsys: struct{ fs.FS }{fsys}, want: "readlink link: unsupported operation"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FromFSFileInfo(tt.fsys, "link", fi)
+			if got.SymlinkTarget != tt.want {
+				t.Errorf("SymlinkTarget = %q, want %q", got.SymlinkTarget, tt.want)
+			}
+			if got.UID != math.MaxUint32 {
+				t.Errorf("UID = %d, want %d for a file without a Stat_t", got.UID, uint32(math.MaxUint32))
+			}
+		})
+	}
+}
+
 func TestFileInfo(t *testing.T) {
 	u, err := user.Current()
 	if err != nil {
@@ -189,3 +239,61 @@ func TestFileInfo(t *testing.T) {
 		})
 	}
 }
+
+func TestLongStringerDevice(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		fi   FileInfo
+		want string
+	}{
+		{
+			name: "char device",
+			fi:   FileInfo{Name: "null", Mode: os.ModeDevice | os.ModeCharDevice | 0o666, Rdev: unix.Mkdev(1, 3), Size: 0},
+			want: "\t1, 3\t",
+		},
+		{
+			name: "block device",
+			fi:   FileInfo{Name: "sda", Mode: os.ModeDevice | 0o660, Rdev: unix.Mkdev(8, 0), Size: 0},
+			want: "\t8, 0\t",
+		},
+		{
+			name: "regular file",
+			fi:   FileInfo{Name: "f", Mode: 0o644, Rdev: unix.Mkdev(8, 0), Size: 1234},
+			want: "\t1234\t",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := LongStringer{Name: NameStringer{}}.FileString(tt.fi)
+			if !strings.Contains(s, tt.want) {
+				t.Errorf("FileString() = %q, want it to contain %q", s, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileInfoNlink(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "f")
+	if err := os.WriteFile(name, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range []string{"g", "h"} {
+		if err := os.Link(name, filepath.Join(dir, l)); err != nil {
+			t.Skipf("hard links not supported: %v", err)
+		}
+	}
+
+	osfi, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi := FromOSFileInfo(name, osfi)
+	if fi.Nlink != 3 {
+		t.Errorf("Nlink = %d, want 3", fi.Nlink)
+	}
+
+	s := LongStringer{Name: NameStringer{}}.FileString(fi)
+	if want := fi.Mode.String() + "\t3\t"; !strings.HasPrefix(s, want) {
+		t.Errorf("FileString() = %q, want prefix %q", s, want)
+	}
+}
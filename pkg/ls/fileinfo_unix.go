@@ -12,12 +12,10 @@ import (
 	"os"
 	"os/user"
 	"regexp"
-	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
-	humanize "github.com/dustin/go-humanize"
 	"golang.org/x/sys/unix"
 )
 
@@ -34,26 +32,39 @@ type FileInfo struct {
 	Name          string
 	Mode          os.FileMode
 	Rdev          uint64
+	Nlink         uint64
 	UID, GID      uint32
 	Size          int64
 	MTime         time.Time
+	ATime, CTime  time.Time
 	SymlinkTarget string
+	// Context is the security context, e.g. as read by SecurityContext.
+	Context string
 }
 
 // FromOSFileInfo converts os.FileInfo to an ls.FileInfo.
 func FromOSFileInfo(path string, fi os.FileInfo) FileInfo {
+	return fromFileInfo(fi, func() (string, error) { return os.Readlink(path) })
+}
+
+// fromFileInfo converts fi to an ls.FileInfo, calling readlink for the
+// target of a symlink.
+func fromFileInfo(fi os.FileInfo, readlink func() (string, error)) FileInfo {
 	var link string
 
 	// A filesystem with a bug will result
 	// in sys not being the right type.
 	// This turns out to be surprisingly messy to test.
 	UID, GID, rdev := uint32(math.MaxUint32), uint32(math.MaxUint32), uint64(math.MaxUint64)
+	nlink := uint64(1)
 	if s, ok := fi.Sys().(*syscall.Stat_t); ok {
-		UID, GID, rdev = s.Uid, s.Gid, uint64(s.Rdev)
+		UID, GID, rdev, nlink = s.Uid, s.Gid, uint64(s.Rdev), uint64(s.Nlink)
 	}
 
+	atime, ctime := statTimes(fi)
+
 	if fi.Mode()&os.ModeType == os.ModeSymlink {
-		if l, err := os.Readlink(path); err != nil {
+		if l, err := readlink(); err != nil {
 			link = err.Error()
 		} else {
 			link = l
@@ -64,10 +75,13 @@ func FromOSFileInfo(path string, fi os.FileInfo) FileInfo {
 		Name:          fi.Name(),
 		Mode:          fi.Mode(),
 		Rdev:          rdev,
+		Nlink:         nlink,
 		UID:           UID,
 		GID:           GID,
 		Size:          fi.Size(),
 		MTime:         fi.ModTime(),
+		ATime:         atime,
+		CTime:         ctime,
 		SymlinkTarget: link,
 	}
 }
@@ -135,8 +149,21 @@ func (qs QuotedStringer) FileString(fi FileInfo) string {
 // LongStringer is a Stringer that returns the file info formatted in `ls -l`
 // long format.
 type LongStringer struct {
+	// Human prints sizes in powers of 1000, e.g. 1.5 kB.
 	Human bool
-	Name  Stringer
+	// IEC prints sizes in powers of 1024, e.g. 1.5 KiB, like ls -h. Human
+	// takes precedence over it.
+	IEC  bool
+	Name Stringer
+	// Octal prepends the permission bits in octal, e.g. 0644.
+	Octal bool
+	// Context adds a column with the security context after the group.
+	Context bool
+	// Time selects the timestamp to show; the default is the
+	// modification time.
+	Time TimeField
+	// Epoch shows the timestamp in seconds since the Unix epoch.
+	Epoch bool
 }
 
 // FileString implements Stringer.FileString.
@@ -145,32 +172,36 @@ func (ls LongStringer) FileString(fi FileInfo) string {
 	// rather use b and c for devices.
 	replacer := strings.NewReplacer("Dc", "c", "D", "b")
 
-	// Ex: crw-rw-rw-  root  root  1, 3  Feb 6 09:31  null
-	pattern := "%[1]s\t%[2]s\t%[3]s\t%[4]d, %[5]d\t%[7]v\t%[8]s"
+	// Ex: crw-rw-rw-  1  root  root  1, 3  Feb 6 09:31  null
+	pattern := "%[1]s\t%[9]d\t%[2]s\t%[3]s\t%[4]d, %[5]d\t%[7]v\t%[8]s"
 	if fi.Mode&os.ModeDevice == 0 && fi.Mode&os.ModeCharDevice == 0 {
-		// Ex: -rw-rw----  myuser  myuser  1256  Feb 6 09:31  recipes.txt
-		pattern = "%[1]s\t%[2]s\t%[3]s\t%[6]s\t%[7]v\t%[8]s"
+		// Ex: -rw-rw----  1  myuser  myuser  1256  Feb 6 09:31  recipes.txt
+		pattern = "%[1]s\t%[9]d\t%[2]s\t%[3]s\t%[6]s\t%[7]v\t%[8]s"
 	}
 
-	var size string
-	if ls.Human {
-		size = humanize.Bytes(uint64(fi.Size))
-	} else {
-		size = strconv.FormatInt(fi.Size, 10)
+	group := lookupGroupName(fi.GID)
+	if ls.Context {
+		group += "\t" + fi.Context
 	}
 
+	size := formatSize(fi.Size, ls.Human, ls.IEC)
+
 	s := fmt.Sprintf(pattern,
 		replacer.Replace(fi.Mode.String()),
 		lookupUserName(fi.UID),
-		lookupGroupName(fi.GID),
+		group,
 		unix.Major(fi.Rdev),
 		unix.Minor(fi.Rdev),
 		size,
-		fi.MTime.Format("Jan _2 15:04"),
-		ls.Name.FileString(fi))
+		formatTime(fi.Time(ls.Time), ls.Epoch),
+		ls.Name.FileString(fi),
+		fi.Nlink)
 
 	if fi.Mode&os.ModeType == os.ModeSymlink {
 		s += fmt.Sprintf(" -> %v", fi.SymlinkTarget)
 	}
+	if ls.Octal {
+		s = OctalMode(fi.Mode) + "\t" + s
+	}
 	return s
 }
@@ -8,10 +8,8 @@ import (
 	"fmt"
 	"os"
 	"regexp"
-	"strconv"
+	"syscall"
 	"time"
-
-	humanize "github.com/dustin/go-humanize"
 )
 
 // Matches characters which would interfere with ls's formatting.
@@ -24,21 +22,37 @@ var unprintableRe = regexp.MustCompile("[[:cntrl:]\n]")
 // `extractImportantParts` populates our own struct which we can modify at will
 // before printing.
 type FileInfo struct {
-	Name  string
-	Mode  os.FileMode
-	UID   string
-	Size  int64
-	MTime time.Time
+	Name         string
+	Mode         os.FileMode
+	UID          string
+	Size         int64
+	MTime        time.Time
+	ATime, CTime time.Time
+	// Context is the security context, e.g. as read by SecurityContext.
+	Context string
 }
 
 // FromOSFileInfo converts os.FileInfo to an ls.FileInfo.
 func FromOSFileInfo(path string, fi os.FileInfo) FileInfo {
+	return fromFileInfo(fi, nil)
+}
+
+// fromFileInfo converts fi to an ls.FileInfo. FileInfo has no symlink target
+// here, so readlink is never called.
+func fromFileInfo(fi os.FileInfo, readlink func() (string, error)) FileInfo {
+	atime := fi.ModTime()
+	if d, ok := fi.Sys().(*syscall.Win32FileAttributeData); ok {
+		atime = time.Unix(0, d.LastAccessTime.Nanoseconds())
+	}
 	return FileInfo{
 		Name:  fi.Name(),
 		Mode:  fi.Mode(),
 		UID:   "bill gates", //fi.Sys().(*syscall.Dir).Uid,
 		Size:  fi.Size(),
 		MTime: fi.ModTime(),
+		ATime: atime,
+		// Windows has no status change time.
+		CTime: fi.ModTime(),
 	}
 }
 
@@ -73,23 +87,39 @@ func (qs QuotedStringer) FileString(fi FileInfo) string {
 // LongStringer is a Stringer that returns the file info formatted in `ls -l`
 // long format.
 type LongStringer struct {
+	// Human prints sizes in powers of 1000, e.g. 1.5 kB.
 	Human bool
-	Name  Stringer
+	// IEC prints sizes in powers of 1024, e.g. 1.5 KiB, like ls -h. Human
+	// takes precedence over it.
+	IEC  bool
+	Name Stringer
+	// Octal prepends the permission bits in octal, e.g. 0644.
+	Octal bool
+	// Context adds a column with the security context after the owner.
+	Context bool
+	// Time selects the timestamp to show; the default is the
+	// modification time.
+	Time TimeField
+	// Epoch shows the timestamp in seconds since the Unix epoch.
+	Epoch bool
 }
 
 // FileString implements Stringer.FileString.
 func (ls LongStringer) FileString(fi FileInfo) string {
-	var size string
-	if ls.Human {
-		size = humanize.Bytes(uint64(fi.Size))
-	} else {
-		size = strconv.FormatInt(fi.Size, 10)
+	size := formatSize(fi.Size, ls.Human, ls.IEC)
+	owner := fi.UID
+	if ls.Context {
+		owner += "\t" + fi.Context
 	}
 	// Ex: -rw-rw----  myuser  1256  Feb 6 09:31  recipes.txt
-	return fmt.Sprintf("%s\t%s\t%s\t%v\t%s",
+	s := fmt.Sprintf("%s\t%s\t%s\t%v\t%s",
 		fi.Mode.String(),
-		fi.UID,
+		owner,
 		size,
-		fi.MTime.Format("Jan _2 15:04"),
+		formatTime(fi.Time(ls.Time), ls.Epoch),
 		ls.Name.FileString(fi))
+	if ls.Octal {
+		s = OctalMode(fi.Mode) + "\t" + s
+	}
+	return s
 }
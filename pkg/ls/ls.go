@@ -4,3 +4,278 @@
 
 // Package ls implements formatting tools to list files like the Linux ls tool.
 package ls
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	humanize "github.com/dustin/go-humanize"
+)
+
+// ReadLinkFS is an fs.FS that knows about symlinks. It has the same shape as
+// fs.ReadLinkFS in newer Go releases; DirFS implements it on all of them.
+type ReadLinkFS interface {
+	fs.FS
+	ReadLink(name string) (string, error)
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+// Lstat returns the FileInfo of name in fsys without following a final
+// symlink if fsys is a ReadLinkFS, and falls back to fs.Stat otherwise.
+func Lstat(fsys fs.FS, name string) (fs.FileInfo, error) {
+	if rl, ok := fsys.(ReadLinkFS); ok {
+		return rl.Lstat(name)
+	}
+	return fs.Stat(fsys, name)
+}
+
+// FromFSFileInfo converts fi, as returned for name by fsys, to an ls.FileInfo.
+// Unlike FromOSFileInfo it never looks at the host file system: symlink
+// targets are read through fsys if it is a ReadLinkFS.
+func FromFSFileInfo(fsys fs.FS, name string, fi fs.FileInfo) FileInfo {
+	return fromFileInfo(fi, func() (string, error) {
+		if rl, ok := fsys.(ReadLinkFS); ok {
+			return rl.ReadLink(name)
+		}
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: errors.ErrUnsupported}
+	})
+}
+
+// OctalMode returns the permission bits of mode, including the setuid, setgid
+// and sticky bits, in the octal form accepted by chmod, e.g. 0644 or 4755.
+func OctalMode(mode os.FileMode) string {
+	m := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		m |= 0o4000
+	}
+	if mode&os.ModeSetgid != 0 {
+		m |= 0o2000
+	}
+	if mode&os.ModeSticky != 0 {
+		m |= 0o1000
+	}
+	return fmt.Sprintf("%04o", m)
+}
+
+// TimeField selects one of the timestamps of a FileInfo.
+type TimeField int
+
+const (
+	// ModTime is the time the contents of the file were last modified.
+	ModTime TimeField = iota
+	// AccessTime is the time the file was last accessed.
+	AccessTime
+	// ChangeTime is the time the file's status, e.g. its permissions, last
+	// changed.
+	ChangeTime
+)
+
+// ParseTimeField parses a `ls --time` argument. It accepts the same words as
+// coreutils, except for the birth time, which is not tracked.
+func ParseTimeField(word string) (TimeField, error) {
+	switch word {
+	case "mtime", "modification":
+		return ModTime, nil
+	case "atime", "access", "use":
+		return AccessTime, nil
+	case "ctime", "status":
+		return ChangeTime, nil
+	}
+	return ModTime, fmt.Errorf("invalid time %q: want one of atime, ctime, mtime", word)
+}
+
+// Time returns the timestamp of fi selected by f.
+func (fi FileInfo) Time(f TimeField) time.Time {
+	switch f {
+	case AccessTime:
+		return fi.ATime
+	case ChangeTime:
+		return fi.CTime
+	default:
+		return fi.MTime
+	}
+}
+
+// formatTime formats t as seconds since the Unix epoch if epoch is set, or
+// like `ls -l` otherwise.
+func formatTime(t time.Time, epoch bool) string {
+	if epoch {
+		return strconv.FormatInt(t.Unix(), 10)
+	}
+	return t.Format("Jan _2 15:04")
+}
+
+// formatSize formats a size in bytes in powers of 1000 if human is set, in
+// powers of 1024 if iec is set, or as a plain number of bytes otherwise.
+func formatSize(size int64, human, iec bool) string {
+	switch {
+	case human:
+		return humanize.Bytes(uint64(size))
+	case iec:
+		return humanize.IBytes(uint64(size))
+	default:
+		return strconv.FormatInt(size, 10)
+	}
+}
+
+// ContextStringer is a Stringer that prefixes the output of Name with the
+// security context of the file, like `ls -Z`.
+type ContextStringer struct {
+	Name Stringer
+}
+
+// FileString implements Stringer.FileString.
+func (cs ContextStringer) FileString(fi FileInfo) string {
+	return fi.Context + " " + cs.Name.FileString(fi)
+}
+
+// A Decorator annotates a listed file, e.g. with its version control status.
+// It returns text to print before and after the entry; either may be empty.
+type Decorator func(fi FileInfo) (prefix, suffix string)
+
+// decorators are the Decorators added with RegisterDecorator, in order.
+var decorators []Decorator
+
+// RegisterDecorator adds d to the annotations the ls command prints for every
+// entry. A build of ls that wants e.g. git status markers adds a file that
+// calls it from an init function; it is not safe for concurrent use.
+func RegisterDecorator(d Decorator) {
+	decorators = append(decorators, d)
+}
+
+// RegisteredDecorator returns a Decorator that applies the registered ones in
+// order, concatenating their prefixes and their suffixes. It returns nil if
+// none is registered.
+func RegisteredDecorator() Decorator {
+	if len(decorators) == 0 {
+		return nil
+	}
+	ds := decorators
+	return func(fi FileInfo) (string, string) {
+		var prefix, suffix string
+		for _, d := range ds {
+			p, s := d(fi)
+			prefix += p
+			suffix += s
+		}
+		return prefix, suffix
+	}
+}
+
+// DecoratedStringer is a Stringer that surrounds the output of Name with the
+// annotations returned by Decorate. A nil Decorate adds nothing.
+type DecoratedStringer struct {
+	Name     Stringer
+	Decorate Decorator
+}
+
+// FileString implements Stringer.FileString.
+func (ds DecoratedStringer) FileString(fi FileInfo) string {
+	if ds.Decorate == nil {
+		return ds.Name.FileString(fi)
+	}
+	prefix, suffix := ds.Decorate(fi)
+	return prefix + ds.Name.FileString(fi) + suffix
+}
+
+// GraphicNameStringer is a Stringer that returns the name with every
+// character that is not graphic, e.g. control characters, tabs and invalid
+// UTF-8, replaced by '?', like `ls -q`.
+type GraphicNameStringer struct{}
+
+// FileString implements Stringer.FileString.
+func (gs GraphicNameStringer) FileString(fi FileInfo) string {
+	return strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || !unicode.IsGraphic(r) {
+			return '?'
+		}
+		return r
+	}, fi.Name)
+}
+
+// FormatStringer is a Stringer that expands a printf-like Format for each
+// file, like `ls --printf`. The tokens are
+//
+//	%n  name
+//	%s  size in bytes
+//	%m  mode, as in long format, e.g. -rw-r--r--
+//	%a  permission bits in octal, e.g. 0644
+//	%t  modification time, as in long format
+//	%T  modification time in seconds since the Unix epoch
+//	%%  a literal %
+//
+// Unknown tokens are copied verbatim; use CheckFormat to reject them.
+type FormatStringer struct {
+	Format string
+}
+
+// FileString implements Stringer.FileString.
+func (fs FormatStringer) FileString(fi FileInfo) string {
+	s, _ := expandFormat(fs.Format, fi)
+	return s
+}
+
+// CheckFormat returns an error if format has a token FormatStringer does not
+// know.
+func CheckFormat(format string) error {
+	_, err := expandFormat(format, FileInfo{})
+	return err
+}
+
+func expandFormat(format string, fi FileInfo) (string, error) {
+	var (
+		b   strings.Builder
+		err error
+	)
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			b.WriteByte(format[i])
+			continue
+		}
+		if i+1 == len(format) {
+			b.WriteByte('%')
+			err = fmt.Errorf("format %q ends in a lone %%", format)
+			break
+		}
+		i++
+		switch format[i] {
+		case 'n':
+			b.WriteString(fi.PrintableName())
+		case 's':
+			b.WriteString(strconv.FormatInt(fi.Size, 10))
+		case 'm':
+			// As in long format, devices are b and c.
+			b.WriteString(strings.NewReplacer("Dc", "c", "D", "b").Replace(fi.Mode.String()))
+		case 'a':
+			b.WriteString(OctalMode(fi.Mode))
+		case 't':
+			b.WriteString(formatTime(fi.MTime, false))
+		case 'T':
+			b.WriteString(formatTime(fi.MTime, true))
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteString(format[i-1 : i+1])
+			if err == nil {
+				err = fmt.Errorf("unknown token %%%c in format %q", format[i], format)
+			}
+		}
+	}
+	return b.String(), err
+}
+
+// RawNameStringer is a Stringer that returns the name unmodified, including
+// any control characters, for consumers that can handle arbitrary names.
+type RawNameStringer struct{}
+
+// FileString implements Stringer.FileString and returns fi's name unmodified.
+func (rs RawNameStringer) FileString(fi FileInfo) string {
+	return fi.Name
+}
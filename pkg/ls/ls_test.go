@@ -0,0 +1,201 @@
+// Copyright 2026 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ls
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestOctalMode(t *testing.T) {
+	for _, tt := range []struct {
+		mode os.FileMode
+		want string
+	}{
+		{0o644, "0644"},
+		{os.ModeDir | 0o755, "0755"},
+		{os.ModeSetuid | 0o755, "4755"},
+		{os.ModeSetgid | 0o750, "2750"},
+		{os.ModeDir | os.ModeSticky | 0o777, "1777"},
+		{os.ModeSetuid | os.ModeSetgid | os.ModeSticky, "7000"},
+	} {
+		if got := OctalMode(tt.mode); got != tt.want {
+			t.Errorf("OctalMode(%v) = %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestContextStringer(t *testing.T) {
+	fi := FileInfo{Name: "passwd", Context: "system_u:object_r:passwd_file_t:s0"}
+	s := ContextStringer{Name: NameStringer{}}
+	if got, want := s.FileString(fi), "system_u:object_r:passwd_file_t:s0 passwd"; got != want {
+		t.Errorf("FileString() = %q, want %q", got, want)
+	}
+}
+
+func TestDecoratedStringer(t *testing.T) {
+	fi := FileInfo{Name: "main.go"}
+	for _, tt := range []struct {
+		name     string
+		decorate Decorator
+		want     string
+	}{
+		{name: "nil decorator", want: "main.go"},
+		{
+			name: "prefix and suffix",
+			decorate: func(fi FileInfo) (string, string) {
+				return "M ", " [" + fi.Name + "]"
+			},
+			want: "M main.go [main.go]",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := DecoratedStringer{Name: NameStringer{}, Decorate: tt.decorate}
+			if got := s.FileString(fi); got != tt.want {
+				t.Errorf("FileString() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterDecorator(t *testing.T) {
+	t.Cleanup(func() { decorators = nil })
+	if d := RegisteredDecorator(); d != nil {
+		t.Fatalf("RegisteredDecorator() = non-nil, want nil with nothing registered")
+	}
+
+	RegisterDecorator(func(FileInfo) (string, string) { return "M", "*" })
+	RegisterDecorator(func(FileInfo) (string, string) { return " ", " [new]" })
+	s := DecoratedStringer{Name: NameStringer{}, Decorate: RegisteredDecorator()}
+	if got, want := s.FileString(FileInfo{Name: "a"}), "M a* [new]"; got != want {
+		t.Errorf("FileString() = %q, want %q", got, want)
+	}
+}
+
+func TestRawNameStringer(t *testing.T) {
+	fi := FileInfo{Name: "a\nb\tc"}
+	if got := (RawNameStringer{}).FileString(fi); got != fi.Name {
+		t.Errorf("FileString() = %q, want %q", got, fi.Name)
+	}
+}
+
+func TestGraphicNameStringer(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		want string
+	}{
+		{"plain.txt", "plain.txt"},
+		{"with space", "with space"},
+		{"tab\there", "tab?here"},
+		{"bell\a\x1b[31mred", "bell??[31mred"},
+		{"line\nbreak", "line?break"},
+		{"h\xffi", "h?i"},
+		{"caf\u00e9", "caf\u00e9"},
+		{"rtl\u202eoverride", "rtl?override"},
+	} {
+		if got := (GraphicNameStringer{}).FileString(FileInfo{Name: tt.name}); got != tt.want {
+			t.Errorf("FileString(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFormatStringer(t *testing.T) {
+	fi := FileInfo{
+		Name:  "notes.txt",
+		Mode:  0o640,
+		Size:  1234,
+		MTime: time.Date(2026, time.March, 4, 5, 6, 7, 0, time.UTC),
+	}
+	for _, tt := range []struct {
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{format: "%n", want: "notes.txt"},
+		{format: "%n\t%s bytes", want: "notes.txt\t1234 bytes"},
+		{format: "%m %a", want: "-rw-r----- 0640"},
+		{format: "%t|%T", want: "Mar  4 05:06|1772600767"},
+		{format: "100%% %n", want: "100% notes.txt"},
+		{format: "no tokens", want: "no tokens"},
+		{format: "%q%n", want: "%qnotes.txt", wantErr: true},
+		{format: "%n%", want: "notes.txt%", wantErr: true},
+	} {
+		if got := (FormatStringer{Format: tt.format}).FileString(fi); got != tt.want {
+			t.Errorf("FileString(%q) = %q, want %q", tt.format, got, tt.want)
+		}
+		if err := CheckFormat(tt.format); (err != nil) != tt.wantErr {
+			t.Errorf("CheckFormat(%q) = %v, want error %t", tt.format, err, tt.wantErr)
+		}
+	}
+
+	dev := FileInfo{Name: "null", Mode: os.ModeDevice | os.ModeCharDevice | 0o666}
+	if got, want := (FormatStringer{Format: "%m"}).FileString(dev), "crw-rw-rw-"; got != want {
+		t.Errorf("FileString(%%m) of a device = %q, want %q", got, want)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	for _, tt := range []struct {
+		size  int64
+		human bool
+		iec   bool
+		want  string
+	}{
+		{size: 1500, want: "1500"},
+		{size: 1500, human: true, want: "1.5 kB"},
+		{size: 1500, iec: true, want: "1.5 KiB"},
+		{size: 1500, human: true, iec: true, want: "1.5 kB"},
+		{size: 3 << 30, iec: true, want: "3.0 GiB"},
+	} {
+		if got := formatSize(tt.size, tt.human, tt.iec); got != tt.want {
+			t.Errorf("formatSize(%d, %t, %t) = %q, want %q", tt.size, tt.human, tt.iec, got, tt.want)
+		}
+	}
+}
+
+func TestTimeField(t *testing.T) {
+	fi := FileInfo{
+		MTime: time.Unix(1, 0),
+		ATime: time.Unix(2, 0),
+		CTime: time.Unix(3, 0),
+	}
+	for _, tt := range []struct {
+		word    string
+		want    time.Time
+		wantErr bool
+	}{
+		{word: "mtime", want: fi.MTime},
+		{word: "modification", want: fi.MTime},
+		{word: "atime", want: fi.ATime},
+		{word: "access", want: fi.ATime},
+		{word: "use", want: fi.ATime},
+		{word: "ctime", want: fi.CTime},
+		{word: "status", want: fi.CTime},
+		{word: "birth", wantErr: true},
+	} {
+		f, err := ParseTimeField(tt.word)
+		if gotErr := err != nil; gotErr != tt.wantErr {
+			t.Errorf("ParseTimeField(%q) = %v, want error %t", tt.word, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got := fi.Time(f); !got.Equal(tt.want) {
+			t.Errorf("Time(%q) = %v, want %v", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	tm := time.Date(2009, time.November, 10, 23, 4, 5, 0, time.UTC)
+	if got, want := formatTime(tm, false), "Nov 10 23:04"; got != want {
+		t.Errorf("formatTime(%v, false) = %q, want %q", tm, got, want)
+	}
+	if got, want := formatTime(tm, true), "1257894245"; got != want {
+		t.Errorf("formatTime(%v, true) = %q, want %q", tm, got, want)
+	}
+}
@@ -0,0 +1,23 @@
+// Copyright 2026 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || freebsd || netbsd
+
+package ls
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// statTimes returns the access and status change times of fi. File systems
+// that do not provide them get the modification time instead.
+func statTimes(fi os.FileInfo) (atime, ctime time.Time) {
+	s, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fi.ModTime(), fi.ModTime()
+	}
+	return time.Unix(s.Atimespec.Unix()), time.Unix(s.Ctimespec.Unix())
+}
@@ -0,0 +1,21 @@
+// Copyright 2026 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ls
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// statTimes returns the access and status change times of fi. File systems
+// that do not provide them get the modification time instead.
+func statTimes(fi os.FileInfo) (atime, ctime time.Time) {
+	s, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fi.ModTime(), fi.ModTime()
+	}
+	return time.Unix(s.Atim.Unix()), time.Unix(s.Ctim.Unix())
+}
@@ -0,0 +1,18 @@
+// Copyright 2026 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux && !darwin && !freebsd && !netbsd && !plan9 && !windows
+
+package ls
+
+import (
+	"os"
+	"time"
+)
+
+// statTimes returns the modification time of fi for both the access and
+// status change times, which are not read on this platform.
+func statTimes(fi os.FileInfo) (atime, ctime time.Time) {
+	return fi.ModTime(), fi.ModTime()
+}